@@ -1,15 +1,203 @@
 package kgetset
 
 import (
+	"os"
+	"time"
+
 	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
+// DynClientConfig holds the settings used to build a
+// DynClient
+//
+// NOTE:
+//  When none of the kubeconfig settings are provided and
+// KUBECONFIG env is not set, in-cluster config is used
+type DynClientConfig struct {
+	// KubeConfigPath is the path to a kubeconfig file
+	KubeConfigPath string
+
+	// Context is the kubeconfig context to use instead
+	// of the current context
+	Context string
+
+	// MasterURL overrides the API server address found
+	// in kubeconfig or in-cluster config
+	MasterURL string
+
+	// MapperBackoff bounds the re-discovery attempts made
+	// when a kind is not known to the RESTMapper
+	MapperBackoff wait.Backoff
+
+	// Timeout is applied to every api call whose context
+	// does not have a deadline
+	Timeout time.Duration
+
+	// QPS & Burst limit the rate of requests made to the API
+	// server. Client-go defaults are used if these are zero.
+	QPS   float32
+	Burst int
+
+	// RetryPolicy decides if & when a failed api call is
+	// retried
+	RetryPolicy RetryPolicy
+
+	// DryRun makes all the mutating api calls dry run
+	DryRun bool
+
+	// DiscoveryCacheDir enables caching of discovery on disk
+	// for DiscoveryCacheTTL. Discovery is cached in memory if
+	// this is not set.
+	DiscoveryCacheDir string
+	DiscoveryCacheTTL time.Duration
+}
+
+// DefaultTimeout is the per call timeout used when none is
+// provided
+const DefaultTimeout = 30 * time.Second
+
+// DefaultMapperBackoff is used to re-discover kinds that are
+// not yet known to the RESTMapper, e.g. kinds of a CRD that
+// got created after the client was built
+var DefaultMapperBackoff = wait.Backoff{
+	Duration: 500 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    6,
+}
+
+// newDynClientConfig returns a new instance of DynClientConfig
+// with defaults & provided options applied
+func newDynClientConfig(options ...func(*DynClientConfig)) *DynClientConfig {
+	cc := &DynClientConfig{
+		MapperBackoff: DefaultMapperBackoff,
+		Timeout:       DefaultTimeout,
+		RetryPolicy:   DefaultRetryPolicy,
+	}
+	for _, o := range options {
+		o(cc)
+	}
+	return cc
+}
+
+// WithKubeConfigPath sets the kubeconfig file to build
+// the client from
+func WithKubeConfigPath(path string) func(*DynClientConfig) {
+	return func(c *DynClientConfig) {
+		c.KubeConfigPath = path
+	}
+}
+
+// WithContext sets the kubeconfig context to build the
+// client from
+func WithContext(context string) func(*DynClientConfig) {
+	return func(c *DynClientConfig) {
+		c.Context = context
+	}
+}
+
+// WithMasterURL sets the API server address
+func WithMasterURL(url string) func(*DynClientConfig) {
+	return func(c *DynClientConfig) {
+		c.MasterURL = url
+	}
+}
+
+// WithMapperBackoff sets the backoff used to re-discover
+// kinds not known to the RESTMapper
+func WithMapperBackoff(backoff wait.Backoff) func(*DynClientConfig) {
+	return func(c *DynClientConfig) {
+		c.MapperBackoff = backoff
+	}
+}
+
+// WithTimeout sets the default timeout of api calls
+func WithTimeout(timeout time.Duration) func(*DynClientConfig) {
+	return func(c *DynClientConfig) {
+		c.Timeout = timeout
+	}
+}
+
+// WithRateLimit sets the QPS & Burst of requests made to the
+// API server
+func WithRateLimit(qps float32, burst int) func(*DynClientConfig) {
+	return func(c *DynClientConfig) {
+		c.QPS = qps
+		c.Burst = burst
+	}
+}
+
+// WithRetryPolicy sets the policy to retry failed api calls
+func WithRetryPolicy(policy RetryPolicy) func(*DynClientConfig) {
+	return func(c *DynClientConfig) {
+		c.RetryPolicy = policy
+	}
+}
+
+// isInCluster returns true if none of the out-of-cluster
+// settings are provided
+func (c *DynClientConfig) isInCluster() bool {
+	return c.KubeConfigPath == "" &&
+		c.Context == "" &&
+		os.Getenv(clientcmd.RecommendedConfigPathEnvVar) == ""
+}
+
+// RESTConfig builds the rest config based on the settings
+//
+// NOTE:
+//  Precedence is explicit kubeconfig path, then KUBECONFIG
+// env, then in-cluster config & finally the default
+// kubeconfig file i.e. $HOME/.kube/config
+func (c *DynClientConfig) RESTConfig() (*rest.Config, error) {
+	if c.isInCluster() {
+		config, err := rest.InClusterConfig()
+		if err == nil {
+			if c.MasterURL != "" {
+				config.Host = c.MasterURL
+			}
+			return config, nil
+		}
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = c.KubeConfigPath
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: c.Context,
+	}
+	overrides.ClusterInfo.Server = c.MasterURL
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		rules,
+		overrides,
+	).ClientConfig()
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"failed to build rest config: kubeconfig %q: context %q",
+			c.KubeConfigPath,
+			c.Context,
+		)
+	}
+	return config, nil
+}
+
+// resettableRESTMapper is a RESTMapper that can drop its
+// cached mappings to have them discovered again
+type resettableRESTMapper interface {
+	meta.RESTMapper
+	Reset()
+}
+
 type DynClient struct {
 	// addToSchemes holds a list of registations
 	// that need to be done against the scheme
@@ -17,57 +205,264 @@ type DynClient struct {
 
 	dynamic dynamic.Interface
 
+	// watchDynamic makes the watch calls
+	//
+	// NOTE:
+	//  This is nil for a fake client
+	watchDynamic dynamic.Interface
+
 	// Mapper is used to map GroupVersionKinds to Resources
-	mapper meta.RESTMapper
+	//
+	// NOTE:
+	//  Mappings are discovered again if a kind is not found
+	mapper resettableRESTMapper
+
+	// discovery lists the api resources served by K8s
+	//
+	// NOTE:
+	//  This shares its cache with the mapper
+	discovery discovery.DiscoveryInterface
+
+	// mapperBackoff bounds the re-discovery attempts
+	mapperBackoff wait.Backoff
+
+	// timeout of an api call whose context has no deadline
+	timeout time.Duration
+
+	// retryPolicy decides if a failed api call is retried
+	retryPolicy RetryPolicy
+
+	// retries is the number of retries made in the current
+	// test run
+	retries int32
+
+	// transcript records every api call made by this client
+	transcript *Transcript
+
+	// config is the rest config this client was built from
+	//
+	// NOTE:
+	//  This is nil for a fake client
+	config *rest.Config
+
+	// identity is the user impersonated by this client if any
+	identity string
+
+	// dryRun makes all the mutating api calls dry run
+	dryRun bool
+
+	// discoveryCache is set if discovery is cached on disk
+	discoveryCache *groupDiscoveryCache
+
+	// deletedGroups are the api groups whose CRD got deleted by
+	// this client. Kinds of these groups are not discovered
+	// again.
+	deletedGroups *groupSet
 }
 
-func NewDynClient() (*DynClient, error) {
-	config, err := rest.InClusterConfig()
+// NewDynClient returns a new instance of DynClient based on
+// the provided options
+func NewDynClient(options ...func(*DynClientConfig)) (*DynClient, error) {
+	cc := newDynClientConfig(options...)
+	config, err := cc.RESTConfig()
 	if err != nil {
 		return nil, err
 	}
-	dyn, err := dynamic.NewForConfig(config)
-	if err != nil {
-		return nil, err
+	return cc.newDynClient(config)
+}
+
+// NewDynClientForConfig returns a new instance of DynClient
+// based on the provided rest config
+func NewDynClientForConfig(
+	config *rest.Config,
+	options ...func(*DynClientConfig),
+) (*DynClient, error) {
+	return newDynClientConfig(options...).newDynClient(config)
+}
+
+func (c *DynClientConfig) newDynClient(config *rest.Config) (*DynClient, error) {
+	config = rest.CopyConfig(config)
+	if c.QPS > 0 {
+		config.QPS = c.QPS
+	}
+	if c.Burst > 0 {
+		config.Burst = c.Burst
 	}
-	dc, err := discovery.NewDiscoveryClientForConfig(config)
+	dyn, watchDyn, err := newDynamicClients(config, c.Timeout)
 	if err != nil {
 		return nil, err
 	}
-	gr, err := restmapper.GetAPIGroupResources(dc)
+	dc, err := discovery.NewDiscoveryClientForConfig(withTimeout(config, c.Timeout))
 	if err != nil {
 		return nil, err
 	}
+	var cached discovery.CachedDiscoveryInterface = memory.NewMemCacheClient(dc)
+	var mapper resettableRESTMapper = restmapper.NewDeferredDiscoveryRESTMapper(cached)
+	var diskCache *groupDiscoveryCache
+	if c.DiscoveryCacheDir != "" {
+		diskCache = newGroupDiscoveryCache(dc, config.Host, c.DiscoveryCacheDir, c.DiscoveryCacheTTL)
+		cached = diskCache
+		mapper = newGroupDiscoveryRESTMapper(diskCache)
+	}
 	return &DynClient{
-		dynamic: dyn,
-		mapper:  restmapper.NewDiscoveryRESTMapper(gr),
+		dynamic:        dyn,
+		watchDynamic:   watchDyn,
+		mapper:         mapper,
+		discovery:      cached,
+		mapperBackoff:  c.MapperBackoff,
+		timeout:        c.Timeout,
+		retryPolicy:    c.RetryPolicy,
+		transcript:     &Transcript{},
+		config:         config,
+		dryRun:         c.DryRun,
+		discoveryCache: diskCache,
+		deletedGroups:  &groupSet{},
 	}, nil
 }
 
-func NewDynClientOrDie() *DynClient {
-	d, err := NewDynClient()
+// withTimeout returns a copy of the provided rest config whose
+// requests are aborted by the transport once they exceed the
+// provided timeout. Timeout set in the rest config is retained.
+func withTimeout(config *rest.Config, timeout time.Duration) *rest.Config {
+	config = rest.CopyConfig(config)
+	if config.Timeout == 0 {
+		config.Timeout = timeout
+	}
+	return config
+}
+
+// newDynamicClients returns the dynamic client that makes the
+// api calls with the provided timeout & the one that makes the
+// watch calls
+//
+// NOTE:
+//  Watches are long running & are bounded by their context
+// instead
+func newDynamicClients(
+	config *rest.Config,
+	timeout time.Duration,
+) (dynamic.Interface, dynamic.Interface, error) {
+	dyn, err := dynamic.NewForConfig(withTimeout(config, timeout))
+	if err != nil {
+		return nil, nil, err
+	}
+	watchDyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dyn, watchDyn, nil
+}
+
+// derive returns a new client that shares the dynamic client,
+// rest mapper & transcript of this client
+func (uc *DynClient) derive() *DynClient {
+	return &DynClient{
+		dynamic:        uc.dynamic,
+		watchDynamic:   uc.watchDynamic,
+		mapper:         uc.mapper,
+		discovery:      uc.discovery,
+		mapperBackoff:  uc.mapperBackoff,
+		timeout:        uc.timeout,
+		retryPolicy:    uc.retryPolicy,
+		transcript:     uc.transcript,
+		config:         uc.config,
+		identity:       uc.identity,
+		dryRun:         uc.dryRun,
+		discoveryCache: uc.discoveryCache,
+		deletedGroups:  uc.deletedGroups,
+	}
+}
+
+func NewDynClientOrDie(options ...func(*DynClientConfig)) *DynClient {
+	d, err := NewDynClient(options...)
 	if err != nil {
 		panic(err)
 	}
 	return d
 }
 
+// RESTMapping returns the mapping of the provided kind
+//
+// NOTE:
+//  If the kind is not known, cached mappings are dropped &
+// discovered again till the mapper backoff is exhausted.
+// This lets suites use kinds of CRDs that got created after
+// this client was built.
+func (uc *DynClient) RESTMapping(gvk schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	var mapping *meta.RESTMapping
+	err := uc.withRediscovery(gvk.Group, gvk.String(), func() (err error) {
+		mapping, err = uc.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// withRediscovery invokes the provided function till it does
+// not fail with a no match error. Cached mappings are dropped
+// & discovered again after every no match error till the
+// mapper backoff is exhausted.
+//
+// NOTE:
+//  Kinds of a group whose CRD got deleted by this client are
+// not discovered again. These are expected to be gone & their
+// no match error is returned right away.
+func (uc *DynClient) withRediscovery(group, what string, fn func() error) error {
+	var err error
+	var deleted bool
+	waitErr := wait.ExponentialBackoff(uc.mapperBackoff, func() (bool, error) {
+		err = fn()
+		if err == nil {
+			return true, nil
+		}
+		if !meta.IsNoMatchError(err) {
+			return false, err
+		}
+		if group != "" && uc.deletedGroups.has(group) {
+			deleted = true
+			return false, err
+		}
+		// kind might have been installed recently
+		uc.mapper.Reset()
+		return false, nil
+	})
+	if deleted {
+		return errors.Wrapf(
+			err,
+			"failed to get rest mapping for %s: crd of group %q got deleted",
+			what,
+			group,
+		)
+	}
+	if waitErr == wait.ErrWaitTimeout {
+		return errors.Wrapf(
+			err,
+			"failed to get rest mapping for %s: %d discovery attempts",
+			what,
+			uc.mapperBackoff.Steps,
+		)
+	}
+	return waitErr
+}
+
 func (uc *DynClient) GetResourceInterface(
 	gvk schema.GroupVersionKind,
 	ns ...string,
 ) (dynamic.ResourceInterface, error) {
-	mapping, err := uc.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	mapping, err := uc.RESTMapping(gvk)
 	if err != nil {
 		return nil, err
 	}
-	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
-		return uc.dynamic.Resource(mapping.Resource), nil
-	}
-	if len(ns) == 0 {
+	if mapping.Scope.Name() != meta.RESTScopeNameRoot && len(ns) == 0 {
 		return nil, errors.Errorf(
 			"failed to get dynamic interface: missing namespace",
 		)
 	}
-	ns0 := ns[0]
-	return uc.dynamic.Resource(mapping.Resource).Namespace(ns0), nil
+	var ns0 string
+	if len(ns) != 0 {
+		ns0 = ns[0]
+	}
+	return uc.resourceInterface(mapping, ns0), nil
 }
@@ -0,0 +1,317 @@
+package kgetset
+
+import (
+	"context"
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/util/retry"
+)
+
+// ApplyMode determines how an object gets applied at K8s
+type ApplyMode string
+
+const (
+	// ClientSideApply merges the desired state locally & then
+	// updates the object at K8s
+	ClientSideApply ApplyMode = "ClientSide"
+
+	// ServerSideApply sends the desired state as an apply
+	// patch & lets K8s do the merge
+	ServerSideApply ApplyMode = "ServerSide"
+)
+
+// DefaultFieldManager is the field manager used by server
+// side apply when none is provided
+const DefaultFieldManager = "kgetset"
+
+// ApplyConfig holds the settings used to apply an object
+type ApplyConfig struct {
+	Mode ApplyMode
+
+	// FieldManager is the name of the actor that owns the
+	// applied fields in case of server side apply
+	FieldManager string
+
+	// Force takes over ownership of conflicting fields in
+	// case of server side apply
+	Force bool
+}
+
+// WithServerSideApply applies the object via server side
+// apply using the provided field manager
+func WithServerSideApply(fieldManager string, force bool) func(*ApplyConfig) {
+	return func(c *ApplyConfig) {
+		c.Mode = ServerSideApply
+		c.FieldManager = fieldManager
+		c.Force = force
+	}
+}
+
+// ApplyResult is the outcome of an apply irrespective of the
+// apply mode
+type ApplyResult struct {
+	Mode ApplyMode
+
+	// Created is true if the object was not present at K8s
+	// before this apply
+	Created bool
+
+	// Object is the object as stored at K8s
+	Object *unstructured.Unstructured
+}
+
+// Apply applies the desired object at K8s. Client side apply
+// is used by default.
+//
+// NOTE:
+//  Client side apply creates the desired object at K8s if it
+// is not present. Otherwise the observed object is merged with
+// the desired object based on the last applied state & then
+// updated at K8s. This is retried on conflicts.
+func (uc *DynClient) Apply(
+	ctx context.Context,
+	desired *unstructured.Unstructured,
+	options ...func(*ApplyConfig),
+) (*ApplyResult, error) {
+	ac := &ApplyConfig{
+		Mode:         ClientSideApply,
+		FieldManager: DefaultFieldManager,
+	}
+	for _, o := range options {
+		o(ac)
+	}
+
+	// normalize the desired state to its json equivalent
+	// since fixtures may use types that can not be merged
+	// or deep copied e.g. map[string]string
+	desiredObj, err := toJSONObject(desired.UnstructuredContent())
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"failed to apply %s %s",
+			desired.GroupVersionKind(),
+			desired.GetName(),
+		)
+	}
+
+	var result *ApplyResult
+	switch ac.Mode {
+	case ClientSideApply:
+		err = retry.RetryOnConflict(retry.DefaultRetry, func() (err error) {
+			result, err = uc.clientSideApply(ctx, desiredObj)
+			return
+		})
+	case ServerSideApply:
+		result, err = uc.serverSideApply(ctx, desiredObj, ac)
+	default:
+		err = errors.Errorf("unsupported apply mode %q", ac.Mode)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"failed to apply %s %s: mode %q",
+			desired.GroupVersionKind(),
+			desired.GetName(),
+			ac.Mode,
+		)
+	}
+	return result, nil
+}
+
+// clientSideApply does a create or an update of the desired
+// object based on its presence at K8s
+func (uc *DynClient) clientSideApply(
+	ctx context.Context,
+	desiredObj map[string]interface{},
+) (*ApplyResult, error) {
+	desired := &unstructured.Unstructured{Object: desiredObj}
+	gvk := desired.GroupVersionKind()
+	namespace := desired.GetNamespace()
+
+	observed, err := uc.Get(ctx, gvk, namespace, desired.GetName())
+	if k8serrors.IsNotFound(err) {
+		obj := desired.DeepCopy()
+		err = SetLastApplied(obj, desiredObj)
+		if err != nil {
+			return nil, err
+		}
+		created, err := uc.Create(ctx, gvk, namespace, obj)
+		if err != nil {
+			return nil, err
+		}
+		return &ApplyResult{Mode: ClientSideApply, Created: true, Object: created}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lastApplied, err := GetLastApplied(observed)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := Merge(observed.UnstructuredContent(), lastApplied, desiredObj)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &unstructured.Unstructured{Object: merged}
+	err = SetLastApplied(obj, desiredObj)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := uc.Update(ctx, gvk, namespace, obj)
+	if err != nil {
+		return nil, err
+	}
+	return &ApplyResult{Mode: ClientSideApply, Object: updated}, nil
+}
+
+// serverSideApply sends the desired object as an apply patch
+func (uc *DynClient) serverSideApply(
+	ctx context.Context,
+	desiredObj map[string]interface{},
+	ac *ApplyConfig,
+) (*ApplyResult, error) {
+	desired := &unstructured.Unstructured{Object: desiredObj}
+	gvk := desired.GroupVersionKind()
+	namespace := desired.GetNamespace()
+
+	_, err := uc.Get(ctx, gvk, namespace, desired.GetName())
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+	created := k8serrors.IsNotFound(err)
+
+	data, err := json.Marshal(desiredObj)
+	if err != nil {
+		return nil, err
+	}
+	options := metav1.PatchOptions{FieldManager: ac.FieldManager}
+	if ac.Force {
+		options.Force = &ac.Force
+	}
+	applied, err := uc.patch(
+		ctx,
+		gvk,
+		namespace,
+		desired.GetName(),
+		types.ApplyPatchType,
+		data,
+		options,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &ApplyResult{Mode: ServerSideApply, Created: created, Object: applied}, nil
+}
+
+// toJSONObject returns the json equivalent of the provided
+// object
+func toJSONObject(obj map[string]interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	jsonObj := make(map[string]interface{})
+	err = json.Unmarshal(raw, &jsonObj)
+	if err != nil {
+		return nil, err
+	}
+	return jsonObj, nil
+}
+
+// serverMetadata are the metadata fields set by K8s for every
+// object
+var serverMetadata = []string{
+	"uid",
+	"resourceVersion",
+	"generation",
+	"creationTimestamp",
+	"selfLink",
+	"managedFields",
+}
+
+// WithoutServerMetadata returns a copy of the provided object
+// without the metadata fields set by K8s e.g. uid or
+// resourceVersion. This lets objects stored at K8s be compared
+// with fixtures or with one another.
+func WithoutServerMetadata(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	stripped := obj.DeepCopy()
+	for _, field := range serverMetadata {
+		unstructured.RemoveNestedField(stripped.Object, "metadata", field)
+	}
+	return stripped
+}
+
+// DiffApplyResults compares the objects stored by the provided
+// applies e.g. of the same fixture via client side & via
+// server side apply. It returns the sorted field paths that
+// differ i.e. top level fields & fields of metadata.
+//
+// NOTE:
+//  Metadata set by K8s, the namespace & the last applied
+// state of client side apply are not compared. This lets the
+// fixture be applied in two namespaces.
+func DiffApplyResults(a, b *ApplyResult) ([]string, error) {
+	if a == nil || a.Object == nil || b == nil || b.Object == nil {
+		return nil, errors.Errorf("failed to diff apply results: missing object")
+	}
+	normalize := func(r *ApplyResult) (map[string]interface{}, error) {
+		obj, err := toJSONObject(WithoutServerMetadata(r.Object).Object)
+		if err != nil {
+			return nil, errors.Wrapf(
+				err,
+				"failed to diff apply results: %s %s",
+				r.Mode,
+				r.Object.GetName(),
+			)
+		}
+		unstructured.RemoveNestedField(obj, "metadata", "namespace")
+		unstructured.RemoveNestedField(obj, "metadata", "annotations", lastAppliedAnnotation)
+		annotations, _, _ := unstructured.NestedMap(obj, "metadata", "annotations")
+		if len(annotations) == 0 {
+			unstructured.RemoveNestedField(obj, "metadata", "annotations")
+		}
+		return obj, nil
+	}
+	objA, err := normalize(a)
+	if err != nil {
+		return nil, err
+	}
+	objB, err := normalize(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	diff := func(prefix string, x, y map[string]interface{}) {
+		keys := map[string]bool{}
+		for k := range x {
+			keys[k] = true
+		}
+		for k := range y {
+			keys[k] = true
+		}
+		for k := range keys {
+			if k == "metadata" && prefix == "" {
+				continue
+			}
+			if !reflect.DeepEqual(x[k], y[k]) {
+				paths = append(paths, prefix+k)
+			}
+		}
+	}
+	diff("", objA, objB)
+	metaA, _, _ := unstructured.NestedMap(objA, "metadata")
+	metaB, _, _ := unstructured.NestedMap(objB, "metadata")
+	diff("metadata.", metaA, metaB)
+	sort.Strings(paths)
+	return paths, nil
+}
@@ -0,0 +1,313 @@
+package kgetset
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestDiffApplyResults(t *testing.T) {
+	newHello := func(namespace, desc string, labels map[string]string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "openebs.io/v1",
+				"kind":       "Hello",
+				"metadata":   map[string]interface{}{"name": "my-hello", "namespace": namespace},
+				"spec":       map[string]interface{}{"desc": desc, "count": 1},
+			},
+		}
+		obj.SetLabels(labels)
+		return obj
+	}
+
+	var tests = map[string]struct {
+		other    *unstructured.Unstructured
+		expected []string
+	}{
+		"same fixture": {
+			other: newHello("b", "hi", map[string]string{"app": "hello"}),
+		},
+		"diff spec": {
+			other:    newHello("b", "bye", map[string]string{"app": "hello"}),
+			expected: []string{"spec"},
+		},
+		"diff labels & spec": {
+			other:    newHello("b", "bye", nil),
+			expected: []string{"metadata.labels", "spec"},
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			client := NewFakeDynClientOrDie(newTestCRD("openebs.io", "hellos", "Hello", nil, nil))
+			a, err := client.Apply(ctx, newHello("a", "hi", map[string]string{"app": "hello"}))
+			if err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+			b, err := client.Apply(ctx, mock.other)
+			if err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+			// stored objects differ in server metadata
+			if a.Object.GetUID() == b.Object.GetUID() {
+				t.Fatalf("test failed: expected distinct objects got uid %q", a.Object.GetUID())
+			}
+			paths, err := DiffApplyResults(a, b)
+			if err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+			if !reflect.DeepEqual(paths, mock.expected) {
+				t.Fatalf("test failed: expected diff %v got %v", mock.expected, paths)
+			}
+		})
+	}
+}
+
+func TestClientSideApply(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "openebs.io", Version: "v1", Kind: "Hello"}
+	newHello := func(spec map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "openebs.io/v1",
+				"kind":       "Hello",
+				"metadata":   map[string]interface{}{"name": "my-hello", "namespace": "default"},
+				"spec":       spec,
+			},
+		}
+	}
+
+	var tests = map[string]struct {
+		// applied are the specs applied in order
+		applied []map[string]interface{}
+
+		// changed are the spec fields set by another actor after
+		// the first apply
+		changed map[string]interface{}
+
+		// conflicts are the updates of the last apply that fail
+		// with a conflict
+		conflicts int
+
+		expected map[string]interface{}
+
+		// calls are the ones made by the last apply
+		calls []string
+	}{
+		"creates": {
+			applied:  []map[string]interface{}{{"desc": "hi", "count": int64(1)}},
+			expected: map[string]interface{}{"desc": "hi", "count": int64(1)},
+			calls:    []string{"get", "create"},
+		},
+		"prunes field removed from the applied state": {
+			applied: []map[string]interface{}{
+				{"desc": "hi", "count": int64(1)},
+				{"desc": "hi"},
+			},
+			expected: map[string]interface{}{"desc": "hi"},
+			calls:    []string{"get", "update"},
+		},
+		"retains field set by another actor": {
+			applied: []map[string]interface{}{
+				{"desc": "hi", "count": int64(1)},
+				{"desc": "bye", "count": int64(1)},
+			},
+			changed:  map[string]interface{}{"owner": "other"},
+			expected: map[string]interface{}{"desc": "bye", "count": int64(1), "owner": "other"},
+			calls:    []string{"get", "update"},
+		},
+		"merges again on conflict": {
+			applied: []map[string]interface{}{
+				{"desc": "hi", "count": int64(1)},
+				{"desc": "hi"},
+			},
+			changed:   map[string]interface{}{"owner": "other"},
+			conflicts: 1,
+			expected:  map[string]interface{}{"desc": "hi", "owner": "other"},
+			calls:     []string{"get", "update", "get", "update"},
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			client := NewFakeDynClientOrDie(newTestCRD("openebs.io", "hellos", "Hello", nil, nil))
+			fake := client.dynamic.(*dynamicfake.FakeDynamicClient)
+			var conflicts int
+			fake.PrependReactor(
+				"update",
+				"hellos",
+				func(clienttesting.Action) (bool, runtime.Object, error) {
+					if conflicts == 0 {
+						return false, nil, nil
+					}
+					conflicts--
+					return true, nil, k8serrors.NewConflict(
+						schema.GroupResource{Group: "openebs.io", Resource: "hellos"},
+						"my-hello",
+						errors.New("object has been modified"),
+					)
+				},
+			)
+
+			var result *ApplyResult
+			for i, spec := range mock.applied {
+				last := i == len(mock.applied)-1
+				if last {
+					conflicts = mock.conflicts
+					fake.ClearActions()
+				}
+				var err error
+				result, err = client.Apply(ctx, newHello(spec))
+				if err != nil {
+					t.Fatalf("test failed: %+v", err)
+				}
+				if last || i > 0 || mock.changed == nil {
+					continue
+				}
+				changed := result.Object.DeepCopy()
+				for k, v := range mock.changed {
+					_ = unstructured.SetNestedField(changed.Object, v, "spec", k)
+				}
+				_, err = client.Update(ctx, gvk, "default", changed)
+				if err != nil {
+					t.Fatalf("test failed: %+v", err)
+				}
+			}
+			var calls []string
+			for _, a := range fake.Actions() {
+				calls = append(calls, a.GetVerb())
+			}
+			if strings.Join(calls, ", ") != strings.Join(mock.calls, ", ") {
+				t.Fatalf("test failed: expected calls %v got %v", mock.calls, calls)
+			}
+
+			if result.Created != (len(mock.applied) == 1) {
+				t.Fatalf("test failed: expected created %t got %t", len(mock.applied) == 1, result.Created)
+			}
+			got, err := client.Get(ctx, gvk, "default", "my-hello")
+			if err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+			if !reflect.DeepEqual(got.Object["spec"], mock.expected) {
+				t.Fatalf("test failed: expected spec %v got %v", mock.expected, got.Object["spec"])
+			}
+			// last applied state is the one applied last
+			lastApplied, err := GetLastApplied(got)
+			if err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+			expected := mock.applied[len(mock.applied)-1]
+			if !reflect.DeepEqual(lastApplied["spec"], expected) {
+				t.Fatalf("test failed: expected last applied spec %v got %v", expected, lastApplied["spec"])
+			}
+		})
+	}
+}
+
+func TestServerSideApply(t *testing.T) {
+	var tests = map[string]struct {
+		exists bool
+	}{
+		"creates": {},
+		"applies existing": {
+			exists: true,
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			exists := mock.exists
+			var contentType string
+			var query url.Values
+			var sent map[string]interface{}
+			server := newTestServer(map[string]http.HandlerFunc{
+				"/apis/openebs.io/v1/namespaces/default/hellos/my-hello": func(w http.ResponseWriter, r *http.Request) {
+					mu.Lock()
+					defer mu.Unlock()
+					switch r.Method {
+					case http.MethodGet:
+						if !exists {
+							writeNotFound(w)
+							return
+						}
+						w.Header().Set("Content-Type", "application/json")
+						_, _ = w.Write([]byte(`{"apiVersion":"openebs.io/v1","kind":"Hello",` +
+							`"metadata":{"name":"my-hello","namespace":"default"}}`))
+					case http.MethodPatch:
+						contentType = r.Header.Get("Content-Type")
+						query = r.URL.Query()
+						body, _ := ioutil.ReadAll(r.Body)
+						_ = json.Unmarshal(body, &sent)
+						exists = true
+						// applied object is returned as is
+						w.Header().Set("Content-Type", "application/json")
+						_, _ = w.Write(body)
+					default:
+						w.WriteHeader(http.StatusMethodNotAllowed)
+					}
+				},
+			})
+			defer server.Close()
+
+			client, err := NewDynClientForConfig(
+				&rest.Config{Host: server.URL},
+				WithRetryPolicy(NoRetryPolicy),
+			)
+			if err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+			hello := &unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": "openebs.io/v1",
+					"kind":       "Hello",
+					"metadata":   map[string]interface{}{"name": "my-hello", "namespace": "default"},
+					"spec":       map[string]interface{}{"desc": "hi", "count": 1},
+				},
+			}
+			result, err := client.Apply(
+				context.Background(),
+				hello,
+				WithServerSideApply("kgetset-test", true),
+			)
+			if err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if contentType != "application/apply-patch+yaml" {
+				t.Fatalf("test failed: expected apply patch got content type %q", contentType)
+			}
+			if query.Get("fieldManager") != "kgetset-test" || query.Get("force") != "true" {
+				t.Fatalf("test failed: expected field manager & force got query %v", query)
+			}
+			desc, _, _ := unstructured.NestedString(sent, "spec", "desc")
+			if desc != "hi" {
+				t.Fatalf("test failed: expected desired object to be sent got %v", sent)
+			}
+			if result.Mode != ServerSideApply || result.Created == mock.exists {
+				t.Fatalf("test failed: expected created %t got %+v", !mock.exists, result)
+			}
+			if result.Object.GetName() != "my-hello" {
+				t.Fatalf("test failed: expected applied object got %v", result.Object)
+			}
+		})
+	}
+}
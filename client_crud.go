@@ -0,0 +1,445 @@
+package kgetset
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// apiCall describes a single api call made by DynClient
+type apiCall struct {
+	verb      string
+	gvk       schema.GroupVersionKind
+	namespace string
+	name      string
+
+	// subresource e.g. status if the call is made to one
+	subresource string
+
+	// gvr is set once the kind is mapped to its resource. It is
+	// set upfront if the resource is known.
+	gvr schema.GroupVersionResource
+
+	// request is the body sent to K8s if any
+	request runtime.Object
+
+	// dryRun is set if the call is not persisted by K8s
+	dryRun bool
+
+	// step is the test step making this call if known from its
+	// context
+	step string
+}
+
+// String implements Stringer interface
+func (a apiCall) String() string {
+	var key = a.name
+	if a.namespace != "" {
+		key = a.namespace + "/" + a.name
+	}
+	if a.subresource != "" {
+		key = key + "/" + a.subresource
+	}
+	var kind fmt.Stringer = a.gvk
+	if a.gvk.Empty() {
+		// call is made to a known resource
+		kind = a.gvr
+	}
+	if a.dryRun {
+		return fmt.Sprintf("%s %s %s (dry run)", a.verb, kind, key)
+	}
+	return fmt.Sprintf("%s %s %s", a.verb, kind, key)
+}
+
+// callResult is the outcome of an api call
+type callResult struct {
+	gvr schema.GroupVersionResource
+	obj runtime.Object
+	err error
+
+	// attempts are the latencies of each attempt of the call
+	attempts []time.Duration
+}
+
+// call maps the kind of the api call to its resource &
+// invokes the provided function against this resource while
+// honouring the context. Client's default timeout is applied
+// if the context does not have a deadline. Failed calls are
+// retried based on the client's retry policy. Every call is
+// recorded in the client's transcript.
+//
+// NOTE:
+//  The dynamic client does not accept a context. Requests are
+// instead aborted by the transport once they exceed the
+// client's timeout. A call whose context ends earlier is
+// abandoned & its result is discarded. Its request is not
+// retried & still ends within the client's timeout.
+func (uc *DynClient) call(
+	ctx context.Context,
+	ac apiCall,
+	fn func(ri dynamic.ResourceInterface) (runtime.Object, error),
+) (runtime.Object, error) {
+	if _, ok := ctx.Deadline(); !ok && uc.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, uc.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	done := make(chan callResult, 1)
+	go func(ac apiCall) {
+		var res callResult
+		gvr, ri, err := uc.resourceInterfaceFor(ac)
+		if err != nil {
+			res.err = err
+			done <- res
+			return
+		}
+		res.gvr = gvr
+		res.err = uc.withRetry(ctx, ac, func() (err error) {
+			attemptStart := time.Now()
+			res.obj, err = fn(ri)
+			res.attempts = append(res.attempts, time.Since(attemptStart))
+			return
+		})
+		done <- res
+	}(ac)
+
+	var res callResult
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		res.err = errors.Wrapf(ctx.Err(), "failed to %s", ac)
+	}
+	if !res.gvr.Empty() {
+		ac.gvr = res.gvr
+	}
+	ac.step, _ = ctx.Value(stepKey{}).(string)
+	uc.record(ac, res, time.Since(start))
+	return res.obj, res.err
+}
+
+// toJSONUnstructured returns a copy of the provided object
+// holding only json types. This is what K8s receives & lets
+// fixtures use go types like int or map[string]string.
+func toJSONUnstructured(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	jsonObj, err := toJSONObject(obj.UnstructuredContent())
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: jsonObj}, nil
+}
+
+// Create creates the provided object at K8s
+func (uc *DynClient) Create(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	obj *unstructured.Unstructured,
+) (*unstructured.Unstructured, error) {
+	body, err := toJSONUnstructured(obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create %q", obj.GetName())
+	}
+	ac := apiCall{
+		verb:      "create",
+		gvk:       gvk,
+		namespace: namespace,
+		name:      obj.GetName(),
+		request:   body,
+		dryRun:    uc.IsDryRun(ctx),
+	}
+	options := metav1.CreateOptions{DryRun: uc.dryRunOption(ctx)}
+	got, err := uc.call(ctx, ac, func(ri dynamic.ResourceInterface) (runtime.Object, error) {
+		return ri.Create(body, options)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if isCRD(body) && !ac.dryRun {
+		uc.crdChanged(crdGroup(body))
+	}
+	return got.(*unstructured.Unstructured), nil
+}
+
+// Get fetches the object with the provided name from K8s
+func (uc *DynClient) Get(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+) (*unstructured.Unstructured, error) {
+	ac := apiCall{verb: "get", gvk: gvk, namespace: namespace, name: name}
+	got, err := uc.call(ctx, ac, func(ri dynamic.ResourceInterface) (runtime.Object, error) {
+		return ri.Get(name, metav1.GetOptions{})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return got.(*unstructured.Unstructured), nil
+}
+
+// Update replaces the provided object at K8s
+func (uc *DynClient) Update(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	obj *unstructured.Unstructured,
+) (*unstructured.Unstructured, error) {
+	body, err := toJSONUnstructured(obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to update %q", obj.GetName())
+	}
+	ac := apiCall{
+		verb:      "update",
+		gvk:       gvk,
+		namespace: namespace,
+		name:      obj.GetName(),
+		request:   body,
+		dryRun:    uc.IsDryRun(ctx),
+	}
+	options := metav1.UpdateOptions{DryRun: uc.dryRunOption(ctx)}
+	got, err := uc.call(ctx, ac, func(ri dynamic.ResourceInterface) (runtime.Object, error) {
+		return ri.Update(body, options)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if isCRD(body) && !ac.dryRun {
+		uc.crdChanged(crdGroup(body))
+	}
+	return got.(*unstructured.Unstructured), nil
+}
+
+// updateObject fetches the object with the provided name,
+// mutates it with the provided function & updates it at K8s.
+// Object is fetched again if the update conflicts. Update is
+// skipped if the function does not change the object.
+//
+// NOTE:
+//  Conflicts are retried as per the backoff of the client's
+// retry policy. Update is attempted at least once.
+func (uc *DynClient) updateObject(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	mutate func(obj *unstructured.Unstructured) (bool, error),
+) (*unstructured.Unstructured, error) {
+	backoff := uc.retryPolicy.Backoff
+	maxAttempts := backoff.Steps
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		var obj *unstructured.Unstructured
+		var changed bool
+		obj, err = uc.Get(ctx, gvk, namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		changed, err = mutate(obj)
+		if err != nil || !changed {
+			return obj, err
+		}
+		obj, err = uc.Update(ctx, gvk, namespace, obj)
+		if ClassifyError(err) != ErrorClassConflict {
+			return obj, err
+		}
+		if attempt >= maxAttempts {
+			return nil, errors.Wrapf(err, "failed to update %q after %d conflicts", name, attempt)
+		}
+		delay := backoff.Step()
+		fmt.Printf("retrying update %q: attempt %d conflicted: next attempt in %s\n", name, attempt, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, errors.Wrapf(err, "failed to update %q: %v", name, ctx.Err())
+		}
+	}
+}
+
+// Delete deletes the object with the provided name from K8s
+func (uc *DynClient) Delete(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	options *metav1.DeleteOptions,
+) error {
+	ac := apiCall{
+		verb:      "delete",
+		gvk:       gvk,
+		namespace: namespace,
+		name:      name,
+		dryRun:    uc.IsDryRun(ctx),
+	}
+	if ac.dryRun {
+		// caller's options are left as is
+		dryRunOptions := metav1.DeleteOptions{}
+		if options != nil {
+			dryRunOptions = *options
+		}
+		dryRunOptions.DryRun = uc.dryRunOption(ctx)
+		options = &dryRunOptions
+	}
+	if options != nil {
+		ac.request = options
+	}
+	_, err := uc.call(ctx, ac, func(ri dynamic.ResourceInterface) (runtime.Object, error) {
+		return nil, ri.Delete(name, options)
+	})
+	if err == nil && gvk.GroupKind() == crdGVK.GroupKind() && !ac.dryRun {
+		uc.crdDeleted(crdGroupOf(name))
+	}
+	return err
+}
+
+// List lists the objects of the provided kind from K8s
+//
+// NOTE:
+//  An empty namespace lists across all namespaces
+func (uc *DynClient) List(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	options metav1.ListOptions,
+) (*unstructured.UnstructuredList, error) {
+	ac := apiCall{verb: "list", gvk: gvk, namespace: namespace}
+	got, err := uc.call(ctx, ac, func(ri dynamic.ResourceInterface) (runtime.Object, error) {
+		return ri.List(options)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return got.(*unstructured.UnstructuredList), nil
+}
+
+// ListResource lists the objects of the provided resource from
+// K8s
+//
+// NOTE:
+//  Unlike List the resource is not mapped from its kind. This
+// lists the custom resources of a CRD that is being deleted
+// without discovering its kind again.
+func (uc *DynClient) ListResource(
+	ctx context.Context,
+	gvr schema.GroupVersionResource,
+	namespace string,
+	options metav1.ListOptions,
+) (*unstructured.UnstructuredList, error) {
+	ac := apiCall{verb: "list", gvr: gvr, namespace: namespace}
+	got, err := uc.call(ctx, ac, func(ri dynamic.ResourceInterface) (runtime.Object, error) {
+		return ri.List(options)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return got.(*unstructured.UnstructuredList), nil
+}
+
+// Patch patches the object with the provided name at K8s
+func (uc *DynClient) Patch(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	pt types.PatchType,
+	data []byte,
+) (*unstructured.Unstructured, error) {
+	return uc.patch(ctx, gvk, namespace, name, pt, data, metav1.PatchOptions{})
+}
+
+func (uc *DynClient) patch(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	pt types.PatchType,
+	data []byte,
+	options metav1.PatchOptions,
+) (*unstructured.Unstructured, error) {
+	ac := apiCall{
+		verb:      "patch",
+		gvk:       gvk,
+		namespace: namespace,
+		name:      name,
+		request:   &runtime.Unknown{Raw: data, ContentType: string(pt)},
+		dryRun:    uc.IsDryRun(ctx),
+	}
+	options.DryRun = uc.dryRunOption(ctx)
+	got, err := uc.call(ctx, ac, func(ri dynamic.ResourceInterface) (runtime.Object, error) {
+		return ri.Patch(name, pt, data, options)
+	})
+	if err != nil {
+		return nil, err
+	}
+	patched := got.(*unstructured.Unstructured)
+	// CRDs applied server side are patched instead of created
+	if gvk.GroupKind() == crdGVK.GroupKind() && !ac.dryRun {
+		uc.crdChanged(crdGroup(patched))
+	}
+	return patched, nil
+}
+
+// resourceInterfaceFor returns the resource of the provided
+// api call & the dynamic interface to make the call with
+//
+// NOTE:
+//  A call whose resource is known is not mapped
+func (uc *DynClient) resourceInterfaceFor(
+	ac apiCall,
+) (schema.GroupVersionResource, dynamic.ResourceInterface, error) {
+	if !ac.gvr.Empty() {
+		if ac.namespace == "" {
+			return ac.gvr, uc.dynamic.Resource(ac.gvr), nil
+		}
+		return ac.gvr, uc.dynamic.Resource(ac.gvr).Namespace(ac.namespace), nil
+	}
+	mapping, err := uc.RESTMapping(ac.gvk)
+	if err != nil {
+		return schema.GroupVersionResource{}, nil, err
+	}
+	if ac.subresource != "" {
+		err = uc.checkSubresource(mapping.Resource, ac.subresource)
+		if err != nil {
+			return mapping.Resource, nil, err
+		}
+	}
+	if ac.verb == "watch" && uc.watchDynamic != nil {
+		return mapping.Resource, resourceInterfaceOf(uc.watchDynamic, mapping, ac.namespace), nil
+	}
+	return mapping.Resource, uc.resourceInterface(mapping, ac.namespace), nil
+}
+
+// resourceInterface returns the dynamic interface of the
+// provided mapping
+func (uc *DynClient) resourceInterface(
+	mapping *meta.RESTMapping,
+	namespace string,
+) dynamic.ResourceInterface {
+	return resourceInterfaceOf(uc.dynamic, mapping, namespace)
+}
+
+// resourceInterfaceOf returns the interface of the provided
+// dynamic client to the provided mapping
+func resourceInterfaceOf(
+	dyn dynamic.Interface,
+	mapping *meta.RESTMapping,
+	namespace string,
+) dynamic.ResourceInterface {
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return dyn.Resource(mapping.Resource)
+	}
+	return dyn.Resource(mapping.Resource).Namespace(namespace)
+}
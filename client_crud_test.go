@@ -0,0 +1,263 @@
+package kgetset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// newTestServer returns a K8s api server that serves the
+// discovery of namespaces & of hellos & byes in openebs.io/v1
+// along with the provided handlers. Hellos enable the status &
+// scale subresources.
+func newTestServer(handlers map[string]http.HandlerFunc) *httptest.Server {
+	mux := http.NewServeMux()
+	serve := func(path, body string) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, body)
+		})
+	}
+	verbs := `"verbs":["create","delete","get","list","patch","update","watch"]`
+	serve("/api", `{"kind":"APIVersions","versions":["v1"]}`)
+	serve(
+		"/apis",
+		`{"kind":"APIGroupList","apiVersion":"v1","groups":[{"name":"openebs.io",`+
+			`"versions":[{"groupVersion":"openebs.io/v1","version":"v1"}],`+
+			`"preferredVersion":{"groupVersion":"openebs.io/v1","version":"v1"}}]}`,
+	)
+	serve(
+		"/api/v1",
+		`{"kind":"APIResourceList","groupVersion":"v1","resources":[`+
+			`{"name":"namespaces","namespaced":false,"kind":"Namespace",`+verbs+`}]}`,
+	)
+	serve(
+		"/apis/openebs.io/v1",
+		`{"kind":"APIResourceList","groupVersion":"openebs.io/v1","resources":[`+
+			`{"name":"hellos","namespaced":true,"kind":"Hello",`+verbs+`},`+
+			`{"name":"hellos/status","namespaced":true,"kind":"Hello","verbs":["get","patch","update"]},`+
+			`{"name":"hellos/scale","namespaced":true,"group":"autoscaling","version":"v1",`+
+			`"kind":"Scale","verbs":["get","patch","update"]},`+
+			`{"name":"byes","namespaced":true,"kind":"Bye",`+verbs+`}]}`,
+	)
+	for path, handler := range handlers {
+		mux.HandleFunc(path, handler)
+	}
+	return httptest.NewServer(mux)
+}
+
+// writeNotFound writes the status K8s returns for an object
+// that is not found
+func writeNotFound(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprint(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`)
+}
+
+// writeJSON writes the provided value as the json body of a
+// response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestCRUD(t *testing.T) {
+	ctx := context.Background()
+	gvk := schema.GroupVersionKind{Group: "openebs.io", Version: "v1", Kind: "Hello"}
+	client := NewFakeDynClientOrDie(newTestCRD("openebs.io", "hellos", "Hello", nil, nil))
+	hello := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "openebs.io/v1",
+			"kind":       "Hello",
+			"metadata":   map[string]interface{}{"name": "my-hello", "namespace": "default"},
+			"spec":       map[string]interface{}{"desc": "hi", "count": 1},
+		},
+	}
+	expectDesc := func(obj *unstructured.Unstructured, expected string) {
+		desc, _, _ := unstructured.NestedString(obj.Object, "spec", "desc")
+		if desc != expected {
+			t.Fatalf("test failed: expected desc %q got %q", expected, desc)
+		}
+	}
+
+	created, err := client.Create(ctx, gvk, "default", hello)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	expectDesc(created, "hi")
+	_, err = client.Create(ctx, gvk, "default", hello)
+	if !k8serrors.IsAlreadyExists(err) {
+		t.Fatalf("test failed: expected already exists got %v", err)
+	}
+
+	got, err := client.Get(ctx, gvk, "default", "my-hello")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	expectDesc(got, "hi")
+
+	err = unstructured.SetNestedField(got.Object, "bye", "spec", "desc")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	_, err = client.Update(ctx, gvk, "default", got)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	got, err = client.Get(ctx, gvk, "default", "my-hello")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	expectDesc(got, "bye")
+
+	patched, err := client.Patch(
+		ctx,
+		gvk,
+		"default",
+		"my-hello",
+		types.MergePatchType,
+		[]byte(`{"spec":{"desc":"hi again"}}`),
+	)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	expectDesc(patched, "hi again")
+
+	list, err := client.List(ctx, gvk, "default", metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if len(list.Items) != 1 || list.Items[0].GetName() != "my-hello" {
+		t.Fatalf("test failed: expected my-hello got %+v", list.Items)
+	}
+
+	err = client.Delete(ctx, gvk, "default", "my-hello", nil)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	_, err = client.Get(ctx, gvk, "default", "my-hello")
+	if !k8serrors.IsNotFound(err) {
+		t.Fatalf("test failed: expected not found got %v", err)
+	}
+
+	var verbs []string
+	for _, e := range client.Transcript().Entries() {
+		verbs = append(verbs, e.Verb)
+	}
+	expected := "create create get update get patch list delete get"
+	if strings.Join(verbs, " ") != expected {
+		t.Fatalf("test failed: expected calls %q got %q", expected, strings.Join(verbs, " "))
+	}
+}
+
+func TestCallIsAbandonedWhenContextIsDone(t *testing.T) {
+	client := NewFakeDynClientOrDie()
+	unblock := make(chan struct{})
+	defer close(unblock)
+	client.dynamic.(*dynamicfake.FakeDynamicClient).PrependReactor(
+		"get",
+		"namespaces",
+		func(clienttesting.Action) (bool, runtime.Object, error) {
+			<-unblock
+			return false, nil, nil
+		},
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.Get(ctx, namespaceGVK, "", "hung")
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Fatalf("test failed: expected deadline exceeded got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("test failed: expected call to be abandoned got %s", elapsed)
+	}
+	entries := client.Transcript().Entries()
+	if len(entries) != 1 || entries[0].Error == "" {
+		t.Fatalf("test failed: expected a failed call in transcript got %+v", entries)
+	}
+}
+
+func TestCallTimeoutAbortsRequest(t *testing.T) {
+	aborted := make(chan struct{})
+	server := newTestServer(map[string]http.HandlerFunc{
+		"/api/v1/namespaces/hung": func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+				close(aborted)
+			case <-time.After(5 * time.Second):
+			}
+		},
+	})
+	defer server.Close()
+
+	client, err := NewDynClientForConfig(
+		&rest.Config{Host: server.URL},
+		WithTimeout(200*time.Millisecond),
+		WithRetryPolicy(NoRetryPolicy),
+	)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	_, err = client.Get(context.Background(), namespaceGVK, "", "hung")
+	if err == nil {
+		t.Fatalf("test failed: expected timeout got nil")
+	}
+	// request is aborted at the server instead of left running
+	select {
+	case <-aborted:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("test failed: expected request to be aborted")
+	}
+}
+
+func TestListResourceOfDeletedCRD(t *testing.T) {
+	ctx := context.Background()
+	crd := newTestCRD("openebs.io", "hellos", "Hello", nil, nil)
+	client := NewFakeDynClientOrDie(crd)
+	gvk := schema.GroupVersionKind{Group: "openebs.io", Version: "v1", Kind: "Hello"}
+	gvr := gvk.GroupVersion().WithResource("hellos")
+	hello := &unstructured.Unstructured{}
+	hello.SetGroupVersionKind(gvk)
+	hello.SetName("my-hello")
+	_, err := client.Create(ctx, gvk, "default", hello)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+
+	for _, expected := range []int{1, 0} {
+		list, err := client.ListResource(ctx, gvr, "default", metav1.ListOptions{})
+		if err != nil {
+			t.Fatalf("test failed: %+v", err)
+		}
+		if len(list.Items) != expected {
+			t.Fatalf("test failed: expected %d hellos got %d", expected, len(list.Items))
+		}
+		// custom resources are deleted along with their crd
+		err = client.Delete(ctx, crdGVK, "", crd.GetName(), nil)
+		if err != nil && !k8serrors.IsNotFound(err) {
+			t.Fatalf("test failed: %+v", err)
+		}
+	}
+	entries := client.Transcript().Entries()
+	last := entries[len(entries)-2]
+	if last.Verb != "list" || last.GVR != gvr.String() {
+		t.Fatalf("test failed: expected list of %s got %s %s", gvr, last.Verb, last.GVR)
+	}
+}
@@ -0,0 +1,338 @@
+package kgetset
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AmitKumarDas/kgetset/unstruct"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ClusterRegistryConfig is used to build a ClusterRegistry
+type ClusterRegistryConfig struct {
+	// KubeConfigPath is the kubeconfig whose contexts are
+	// used to reach the clusters. KUBECONFIG env & then the
+	// default kubeconfig file are used if this is not set.
+	KubeConfigPath string
+
+	// Contexts are the kubeconfig contexts to be registered.
+	// All the contexts are registered if this is not set.
+	Contexts []string
+
+	// ClientOptions are applied to every cluster's client
+	ClientOptions []func(*DynClientConfig)
+}
+
+// WithRegistryKubeConfigPath sets the kubeconfig whose
+// contexts are registered
+func WithRegistryKubeConfigPath(path string) func(*ClusterRegistryConfig) {
+	return func(c *ClusterRegistryConfig) {
+		c.KubeConfigPath = path
+	}
+}
+
+// WithRegistryContexts limits the registry to the provided
+// kubeconfig contexts
+func WithRegistryContexts(contexts ...string) func(*ClusterRegistryConfig) {
+	return func(c *ClusterRegistryConfig) {
+		c.Contexts = append(c.Contexts, contexts...)
+	}
+}
+
+// WithRegistryClientOptions sets the options used to build
+// every cluster's client
+func WithRegistryClientOptions(options ...func(*DynClientConfig)) func(*ClusterRegistryConfig) {
+	return func(c *ClusterRegistryConfig) {
+		c.ClientOptions = append(c.ClientOptions, options...)
+	}
+}
+
+// ClusterRegistry holds a client per cluster keyed by the
+// cluster name
+//
+// NOTE:
+//  A cluster is named after its kubeconfig context
+type ClusterRegistry struct {
+	mu      sync.RWMutex
+	clients map[string]*DynClient
+}
+
+// NewClusterRegistry returns a registry with a client per
+// kubeconfig context
+func NewClusterRegistry(options ...func(*ClusterRegistryConfig)) (*ClusterRegistry, error) {
+	c := &ClusterRegistryConfig{}
+	for _, o := range options {
+		o(c)
+	}
+
+	contexts := c.Contexts
+	if len(contexts) == 0 {
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		rules.ExplicitPath = c.KubeConfigPath
+		raw, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			rules,
+			&clientcmd.ConfigOverrides{},
+		).RawConfig()
+		if err != nil {
+			return nil, errors.Wrapf(
+				err,
+				"failed to load kubeconfig contexts: kubeconfig %q",
+				c.KubeConfigPath,
+			)
+		}
+		for name := range raw.Contexts {
+			contexts = append(contexts, name)
+		}
+	}
+	if len(contexts) == 0 {
+		return nil, errors.Errorf(
+			"failed to build cluster registry: no contexts: kubeconfig %q",
+			c.KubeConfigPath,
+		)
+	}
+
+	r := NewClusterRegistryForClients(nil)
+	for _, name := range contexts {
+		clientOpts := append(
+			append([]func(*DynClientConfig){}, c.ClientOptions...),
+			WithKubeConfigPath(c.KubeConfigPath),
+			WithContext(name),
+		)
+		client, err := NewDynClient(clientOpts...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to build client for cluster %q", name)
+		}
+		r.Add(name, client)
+	}
+	return r, nil
+}
+
+// NewClusterRegistryForClients returns a registry with the
+// provided clients keyed by their cluster names
+func NewClusterRegistryForClients(clients map[string]*DynClient) *ClusterRegistry {
+	r := &ClusterRegistry{clients: map[string]*DynClient{}}
+	for name, client := range clients {
+		r.Add(name, client)
+	}
+	return r
+}
+
+// Add registers the provided client against the cluster name
+func (r *ClusterRegistry) Add(name string, client *DynClient) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clients[name] = client
+}
+
+// Names returns the sorted names of registered clusters
+func (r *ClusterRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var names []string
+	for name := range r.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Client returns the client of the provided cluster
+func (r *ClusterRegistry) Client(name string) (*DynClient, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	client, ok := r.clients[name]
+	if !ok {
+		return nil, errors.Errorf("cluster %q is not registered", name)
+	}
+	return client, nil
+}
+
+// ClusterResult is the outcome of running against a cluster
+type ClusterResult struct {
+	Cluster string
+	Err     error
+	Elapsed time.Duration
+
+	// SkipReason is set if the testsuite was not applicable to
+	// this cluster
+	SkipReason string
+}
+
+// ClusterResults are the outcomes of running against every
+// registered cluster
+type ClusterResults []ClusterResult
+
+// Failed returns the results that have an error
+func (rs ClusterResults) Failed() ClusterResults {
+	var failed ClusterResults
+	for _, r := range rs {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+// Err returns an error listing the failed clusters if any
+func (rs ClusterResults) Err() error {
+	failed := rs.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	var msgs []string
+	for _, r := range failed {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", r.Cluster, r.Err))
+	}
+	return errors.Errorf(
+		"failed on %d of %d clusters: %s",
+		len(failed),
+		len(rs),
+		strings.Join(msgs, ": "),
+	)
+}
+
+// String implements Stringer interface
+func (rs ClusterResults) String() string {
+	var lines []string
+	for _, r := range rs {
+		status := "passed"
+		if r.Err != nil {
+			status = fmt.Sprintf("failed: %v", r.Err)
+		} else if r.SkipReason != "" {
+			status = fmt.Sprintf("skipped: %s", r.SkipReason)
+		}
+		lines = append(
+			lines,
+			fmt.Sprintf("%s %s in %s", r.Cluster, status, r.Elapsed),
+		)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// RunOnEach invokes the provided function against every
+// registered cluster & returns the per cluster results
+//
+// NOTE:
+//  Clusters are run one after the other in the order of
+// their names. This keeps the step logs of a cluster
+// together.
+func (r *ClusterRegistry) RunOnEach(
+	fn func(cluster string, client *DynClient) error,
+) ClusterResults {
+	var results ClusterResults
+	for _, name := range r.Names() {
+		client, err := r.Client(name)
+		if err != nil {
+			results = append(results, ClusterResult{Cluster: name, Err: err})
+			continue
+		}
+		fmt.Printf("running against cluster %q\n", name)
+		start := time.Now()
+		err = fn(name, client)
+		results = append(
+			results,
+			ClusterResult{Cluster: name, Err: err, Elapsed: time.Since(start)},
+		)
+	}
+	return results
+}
+
+// TestOnEach builds a testsuite per cluster using the provided
+// function & runs it against every registered cluster
+//
+// NOTE:
+//  A testsuite that reports its TestResult e.g. TestAbstract
+// gets the reason it was skipped on a cluster reported too
+func (r *ClusterRegistry) TestOnEach(
+	newSuite func(client *DynClient) Testsuite,
+) ClusterResults {
+	skipped := map[string]string{}
+	results := r.RunOnEach(func(cluster string, client *DynClient) error {
+		suite := newSuite(client)
+		err := suite.Test()
+		if s, ok := suite.(interface{ Result() TestResult }); ok {
+			skipped[cluster] = s.Result().SkipReason
+		}
+		return err
+	})
+	for i := range results {
+		results[i].SkipReason = skipped[results[i].Cluster]
+	}
+	return results
+}
+
+// ClusterDiff is the difference of an object stored at a
+// cluster from the one stored at the reference cluster
+type ClusterDiff struct {
+	Cluster string
+
+	// Paths are the compared field paths that differ
+	Paths []string
+}
+
+// Diff fetches the provided object from every registered
+// cluster & compares the provided field paths against the
+// object of the first cluster. Only the clusters whose object
+// differs are returned.
+//
+// NOTE:
+//  Paths are dot separated e.g. spec or metadata.labels.
+// Spec is compared if no paths are provided.
+func (r *ClusterRegistry) Diff(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	paths ...string,
+) ([]ClusterDiff, error) {
+	if len(paths) == 0 {
+		paths = []string{"spec"}
+	}
+	names := r.Names()
+	if len(names) == 0 {
+		return nil, errors.Errorf("failed to diff %q: no clusters", name)
+	}
+
+	var ref *unstructured.Unstructured
+	var diffs []ClusterDiff
+	for _, cluster := range names {
+		client, err := r.Client(cluster)
+		if err != nil {
+			return nil, err
+		}
+		obj, err := client.Get(ctx, gvk, namespace, name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to diff: cluster %q", cluster)
+		}
+		if ref == nil {
+			ref = obj
+			continue
+		}
+		diff := ClusterDiff{Cluster: cluster}
+		for _, p := range paths {
+			changed, err := unstruct.IsChange(ref, obj, p)
+			if err != nil {
+				return nil, errors.Wrapf(
+					err,
+					"failed to diff %q: cluster %q",
+					p,
+					cluster,
+				)
+			}
+			if changed {
+				diff.Paths = append(diff.Paths, p)
+			}
+		}
+		if len(diff.Paths) > 0 {
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs, nil
+}
@@ -0,0 +1,110 @@
+package kgetset
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const twoClusterKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: east
+  cluster:
+    server: https://127.0.0.1:6443
+- name: west
+  cluster:
+    server: https://127.0.0.1:7443
+users:
+- name: admin
+  user:
+    token: abc
+contexts:
+- name: east
+  context:
+    cluster: east
+    user: admin
+- name: west
+  context:
+    cluster: west
+    user: admin
+current-context: east
+`
+
+func TestNewClusterRegistryFromKubeConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kgetset")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config")
+	err = ioutil.WriteFile(path, []byte(twoClusterKubeConfig), 0600)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+
+	r, err := NewClusterRegistry(WithRegistryKubeConfigPath(path))
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	names := r.Names()
+	if len(names) != 2 || names[0] != "east" || names[1] != "west" {
+		t.Fatalf("test failed: expected [east west] got %v", names)
+	}
+	west, err := r.Client("west")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if west.config.Host != "https://127.0.0.1:7443" {
+		t.Fatalf("test failed: expected west host got %q", west.config.Host)
+	}
+}
+
+func TestClusterRegistryDiff(t *testing.T) {
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}
+	newNS := func(team string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Namespace",
+				"metadata": map[string]interface{}{
+					"name":   "kgetset",
+					"labels": map[string]interface{}{"team": team},
+				},
+				"spec": map[string]interface{}{
+					"finalizers": []interface{}{"kubernetes"},
+				},
+			},
+		}
+	}
+	r := NewClusterRegistryForClients(map[string]*DynClient{
+		"east":  NewFakeDynClientOrDie(newNS("storage")),
+		"west":  NewFakeDynClientOrDie(newNS("storage")),
+		"north": NewFakeDynClientOrDie(newNS("network")),
+	})
+
+	diffs, err := r.Diff(context.Background(), gvk, "", "kgetset", "spec", "metadata.labels")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	// east is the reference since it is first by name
+	if len(diffs) != 1 || diffs[0].Cluster != "north" {
+		t.Fatalf("test failed: expected diff at north got %+v", diffs)
+	}
+	if len(diffs[0].Paths) != 1 || diffs[0].Paths[0] != "metadata.labels" {
+		t.Fatalf("test failed: expected metadata.labels got %v", diffs[0].Paths)
+	}
+
+	results := r.RunOnEach(func(cluster string, client *DynClient) error {
+		_, err := client.Get(context.Background(), gvk, "", "kgetset")
+		return err
+	})
+	if len(results) != 3 || results.Err() != nil {
+		t.Fatalf("test failed: %s", results)
+	}
+}
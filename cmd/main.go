@@ -1,13 +1,145 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	kgs "github.com/AmitKumarDas/kgetset"
 	testing "github.com/AmitKumarDas/kgetset/onegvkdiffschemas"
 )
 
+var (
+	kubeconfig = flag.String(
+		"kubeconfig", "", "path to kubeconfig; in-cluster config is used if not set",
+	)
+	kubecontext = flag.String(
+		"context", "", "kubeconfig context to use",
+	)
+	master = flag.String(
+		"master", "", "url of K8s api server; overrides the one in kubeconfig",
+	)
+	transcript = flag.String(
+		"transcript", "", "file to write api call transcript as json lines; - for stdout; disabled if not set",
+	)
+	sweepAge = flag.Duration(
+		"sweep-age", kgs.DefaultSweepAge, "age after which namespaces & crds of earlier runs are deleted",
+	)
+	forceFinalize = flag.Bool(
+		"force-finalize", false, "remove finalizers of fixtures whose deletion gets stuck in teardown",
+	)
+	latencyReport = flag.String(
+		"latency-report", "", "file to write api latencies of this run as json",
+	)
+	latencyBaseline = flag.String(
+		"latency-baseline", "", "latency report of an earlier run to detect regressions against",
+	)
+	discoveryCache = flag.String(
+		"discovery-cache", "", "directory to cache discovery in across runs; disabled if not set",
+	)
+	discoveryCacheTTL = flag.Duration(
+		"discovery-cache-ttl", kgs.DefaultDiscoveryCacheTTL, "time till which cached discovery is used",
+	)
+	latencyFactor = flag.Float64(
+		"latency-factor", 10, "p50 latency growth over the baseline that is reported as regression",
+	)
+)
+
 func main() {
-	c := testing.NewTestA()
-	err := c.Test()
+	flag.Parse()
+
+	client := kgs.NewDynClientOrDie(
+		kgs.WithKubeConfigPath(*kubeconfig),
+		kgs.WithContext(*kubecontext),
+		kgs.WithMasterURL(*master),
+		kgs.WithDiscoveryCache(*discoveryCache, *discoveryCacheTTL),
+	)
+	runID := kgs.NewRunID()
+	fmt.Printf("starting run %q\n", runID)
+
+	// namespaces & crds left over by crashed runs are deleted
+	_, err := client.SweepRunNamespaces(context.Background(), *sweepAge, runID)
+	if err != nil {
+		fmt.Printf("%+v\n", err)
+	}
+	_, err = client.SweepRunCRDs(context.Background(), *sweepAge, runID)
+	if err != nil {
+		fmt.Printf("%+v\n", err)
+	}
+
+	options := []func(*testing.TestA){
+		testing.WithClient(client),
+		testing.WithRunID(runID),
+	}
+	if *forceFinalize {
+		options = append(options, testing.WithForceFinalize())
+	}
+	c := testing.NewTestA(options...)
+	err = c.Test()
+
+	// transcript is written even if the test failed
+	werr := writeTranscript(client.Transcript())
+	if werr != nil {
+		fmt.Printf("%+v\n", werr)
+	}
+	// latencies are reported even if the test passed
+	werr = reportLatencies(c.Result().Latencies)
+	if werr != nil {
+		fmt.Printf("%+v\n", werr)
+	}
 	if err != nil {
 		panic(err)
 	}
 }
+
+func reportLatencies(report kgs.LatencyReport) error {
+	fmt.Printf("api latencies:\n%s", report)
+	if *latencyReport != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(*latencyReport, data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	if *latencyBaseline == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(*latencyBaseline)
+	if err != nil {
+		return err
+	}
+	var baseline kgs.LatencyReport
+	err = json.Unmarshal(data, &baseline)
+	if err != nil {
+		return err
+	}
+	for _, r := range report.Regressions(baseline, *latencyFactor) {
+		fmt.Printf("latency regression: %s\n", r)
+	}
+	return nil
+}
+
+func writeTranscript(t *kgs.Transcript) error {
+	if *transcript == "" {
+		return nil
+	}
+	// stdout is used only on request since it mixes the json
+	// lines with the test's logs
+	var w io.Writer = os.Stdout
+	if *transcript != "-" {
+		f, err := os.Create(*transcript)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return t.WriteJSONLines(w)
+}
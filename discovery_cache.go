@@ -0,0 +1,450 @@
+package kgetset
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/restmapper"
+)
+
+// DefaultDiscoveryCacheTTL is the time till which cached
+// discovery is used when no ttl is provided
+const DefaultDiscoveryCacheTTL = 10 * time.Minute
+
+// WithDiscoveryCache caches discovery of api resources in the
+// provided directory for the provided ttl. This lets clients
+// of later runs skip discovery.
+//
+// NOTE:
+//  Each API server gets a directory of its own named after
+// its host
+func WithDiscoveryCache(dir string, ttl time.Duration) func(*DynClientConfig) {
+	return func(c *DynClientConfig) {
+		c.DiscoveryCacheDir = dir
+		c.DiscoveryCacheTTL = ttl
+	}
+}
+
+// invalidHostChars are the characters of a host that do not
+// make a portable directory name
+var invalidHostChars = regexp.MustCompile(`[^\w.-]`)
+
+// hostCacheDir returns the cache directory of the provided
+// API server host
+func hostCacheDir(parent, host string) string {
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+	return filepath.Join(parent, invalidHostChars.ReplaceAllString(host, "_"))
+}
+
+// groupDiscoveryCache caches discovery on disk & can be
+// invalidated for a single api group
+//
+// NOTE:
+//  Files are laid out the way kubectl does i.e. the list of
+// groups in servergroups.json & resources of a group version
+// in <group>/<version>/serverresources.json
+type groupDiscoveryCache struct {
+	discovery.DiscoveryInterface
+
+	// dir holds the cached files of a single API server
+	dir string
+	ttl time.Duration
+
+	mu sync.Mutex
+
+	// ours are the files written since the last invalidation
+	ours map[string]bool
+
+	// invalidated ignores the files that are not ours
+	invalidated bool
+
+	// fresh is true if nothing was read from older files
+	fresh bool
+}
+
+// newGroupDiscoveryCache returns a discovery cache on disk for
+// the API server with the provided host
+func newGroupDiscoveryCache(
+	delegate discovery.DiscoveryInterface,
+	host string,
+	parent string,
+	ttl time.Duration,
+) *groupDiscoveryCache {
+	if ttl <= 0 {
+		ttl = DefaultDiscoveryCacheTTL
+	}
+	return &groupDiscoveryCache{
+		DiscoveryInterface: delegate,
+		dir:                hostCacheDir(parent, host),
+		ttl:                ttl,
+		ours:               map[string]bool{},
+		fresh:              true,
+	}
+}
+
+// ServerGroups implements discovery.DiscoveryInterface
+func (c *groupDiscoveryCache) ServerGroups() (*metav1.APIGroupList, error) {
+	file := filepath.Join(c.dir, "servergroups.json")
+	groups := &metav1.APIGroupList{}
+	if c.read(file, groups) {
+		return groups, nil
+	}
+	groups, err := c.DiscoveryInterface.ServerGroups()
+	if err != nil {
+		return nil, err
+	}
+	c.write(file, groups)
+	return groups, nil
+}
+
+// ServerResourcesForGroupVersion implements
+// discovery.DiscoveryInterface
+func (c *groupDiscoveryCache) ServerResourcesForGroupVersion(
+	groupVersion string,
+) (*metav1.APIResourceList, error) {
+	file := filepath.Join(c.dir, groupVersion, "serverresources.json")
+	list := &metav1.APIResourceList{}
+	if c.read(file, list) {
+		return list, nil
+	}
+	list, err := c.DiscoveryInterface.ServerResourcesForGroupVersion(groupVersion)
+	if err != nil {
+		return list, err
+	}
+	c.write(file, list)
+	return list, nil
+}
+
+// ServerGroupsAndResources implements
+// discovery.DiscoveryInterface
+func (c *groupDiscoveryCache) ServerGroupsAndResources() (
+	[]*metav1.APIGroup,
+	[]*metav1.APIResourceList,
+	error,
+) {
+	return discovery.ServerGroupsAndResources(c)
+}
+
+// ServerPreferredResources implements
+// discovery.DiscoveryInterface
+func (c *groupDiscoveryCache) ServerPreferredResources() ([]*metav1.APIResourceList, error) {
+	return discovery.ServerPreferredResources(c)
+}
+
+// ServerPreferredNamespacedResources implements
+// discovery.DiscoveryInterface
+func (c *groupDiscoveryCache) ServerPreferredNamespacedResources() ([]*metav1.APIResourceList, error) {
+	return discovery.ServerPreferredNamespacedResources(c)
+}
+
+// read decodes the provided cached file into the provided
+// object. It returns false if the file is missing, expired or
+// invalidated.
+func (c *groupDiscoveryCache) read(file string, into interface{}) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.invalidated && !c.ours[file] {
+		return false
+	}
+	info, err := os.Stat(file)
+	if err != nil || time.Since(info.ModTime()) > c.ttl {
+		return false
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil || json.Unmarshal(data, into) != nil {
+		return false
+	}
+	c.fresh = c.fresh && c.ours[file]
+	return true
+}
+
+// write caches the provided object in the provided file
+//
+// NOTE:
+//  Cache is best effort. Failed writes are ignored & only
+// cost a discovery later.
+func (c *groupDiscoveryCache) write(file string, obj interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return
+	}
+	err = os.MkdirAll(filepath.Dir(file), 0750)
+	if err != nil {
+		return
+	}
+	// concurrent runs never read a partially written file
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	cerr := tmp.Close()
+	if err != nil || cerr != nil || os.Rename(tmp.Name(), file) != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	c.ours[file] = true
+}
+
+// Fresh implements discovery.CachedDiscoveryInterface
+func (c *groupDiscoveryCache) Fresh() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fresh
+}
+
+// Invalidate implements discovery.CachedDiscoveryInterface
+func (c *groupDiscoveryCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidated = true
+	c.ours = map[string]bool{}
+	c.fresh = true
+}
+
+// invalidateGroup removes the cached files of the provided
+// group along with the list of groups
+func (c *groupDiscoveryCache) invalidateGroup(group string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	paths := []string{filepath.Join(c.dir, "servergroups.json")}
+	if group == "" {
+		// core group is cached as its versions
+		paths = append(paths, filepath.Join(c.dir, "v1"))
+	} else {
+		paths = append(paths, filepath.Join(c.dir, group))
+	}
+	for _, p := range paths {
+		err := os.RemoveAll(p)
+		if err != nil {
+			return errors.Wrapf(err, "failed to invalidate discovery cache of group %q", group)
+		}
+	}
+	return nil
+}
+
+// groupDiscoveryRESTMapper is a deferred discovery rest mapper
+// whose mappings can be dropped without invalidating the whole
+// discovery cache
+//
+// NOTE:
+//  Reset of a deferred discovery rest mapper invalidates its
+// discovery cache. This replaces the deferred mapper instead
+// so that only the files removed from the cache are discovered
+// again.
+type groupDiscoveryRESTMapper struct {
+	cache discovery.CachedDiscoveryInterface
+
+	mu     sync.RWMutex
+	mapper *restmapper.DeferredDiscoveryRESTMapper
+}
+
+// newGroupDiscoveryRESTMapper returns a rest mapper that maps
+// kinds as discovered via the provided cache
+func newGroupDiscoveryRESTMapper(cache discovery.CachedDiscoveryInterface) *groupDiscoveryRESTMapper {
+	return &groupDiscoveryRESTMapper{
+		cache:  cache,
+		mapper: restmapper.NewDeferredDiscoveryRESTMapper(cache),
+	}
+}
+
+// current returns the deferred mapper in use
+func (m *groupDiscoveryRESTMapper) current() *restmapper.DeferredDiscoveryRESTMapper {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.mapper
+}
+
+// forget drops the mappings while retaining the cache
+func (m *groupDiscoveryRESTMapper) forget() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mapper = restmapper.NewDeferredDiscoveryRESTMapper(m.cache)
+}
+
+// Reset drops the mappings & invalidates the cache
+func (m *groupDiscoveryRESTMapper) Reset() {
+	m.current().Reset()
+}
+
+// KindFor implements meta.RESTMapper
+func (m *groupDiscoveryRESTMapper) KindFor(
+	resource schema.GroupVersionResource,
+) (schema.GroupVersionKind, error) {
+	return m.current().KindFor(resource)
+}
+
+// KindsFor implements meta.RESTMapper
+func (m *groupDiscoveryRESTMapper) KindsFor(
+	resource schema.GroupVersionResource,
+) ([]schema.GroupVersionKind, error) {
+	return m.current().KindsFor(resource)
+}
+
+// ResourceFor implements meta.RESTMapper
+func (m *groupDiscoveryRESTMapper) ResourceFor(
+	input schema.GroupVersionResource,
+) (schema.GroupVersionResource, error) {
+	return m.current().ResourceFor(input)
+}
+
+// ResourcesFor implements meta.RESTMapper
+func (m *groupDiscoveryRESTMapper) ResourcesFor(
+	input schema.GroupVersionResource,
+) ([]schema.GroupVersionResource, error) {
+	return m.current().ResourcesFor(input)
+}
+
+// RESTMapping implements meta.RESTMapper
+func (m *groupDiscoveryRESTMapper) RESTMapping(
+	gk schema.GroupKind,
+	versions ...string,
+) (*meta.RESTMapping, error) {
+	return m.current().RESTMapping(gk, versions...)
+}
+
+// RESTMappings implements meta.RESTMapper
+func (m *groupDiscoveryRESTMapper) RESTMappings(
+	gk schema.GroupKind,
+	versions ...string,
+) ([]*meta.RESTMapping, error) {
+	return m.current().RESTMappings(gk, versions...)
+}
+
+// ResourceSingularizer implements meta.RESTMapper
+func (m *groupDiscoveryRESTMapper) ResourceSingularizer(resource string) (string, error) {
+	return m.current().ResourceSingularizer(resource)
+}
+
+// InvalidateDiscoveryGroup drops the cached discovery of the
+// provided api group. Kinds of this group are discovered again
+// on their next use.
+//
+// NOTE:
+//  This is done on changes to CRDs made via this client.
+// Cached discovery of other groups is retained if the client
+// uses a discovery cache on disk.
+func (uc *DynClient) InvalidateDiscoveryGroup(group string) error {
+	if uc.discoveryCache == nil {
+		uc.mapper.Reset()
+		return nil
+	}
+	err := uc.discoveryCache.invalidateGroup(group)
+	if err != nil {
+		return err
+	}
+	if mapper, ok := uc.mapper.(*groupDiscoveryRESTMapper); ok {
+		mapper.forget()
+		return nil
+	}
+	uc.mapper.Reset()
+	return nil
+}
+
+// crdGroup returns the api group served by the provided CRD
+func crdGroup(crd *unstructured.Unstructured) string {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	if group != "" {
+		return group
+	}
+	return crdGroupOf(crd.GetName())
+}
+
+// crdGroupOf returns the api group of the CRD with the
+// provided name i.e. <plural>.<group>
+func crdGroupOf(name string) string {
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// crdChanged invalidates the cached discovery of the group of
+// a CRD that got created, updated or patched
+func (uc *DynClient) crdChanged(group string) {
+	if group == "" {
+		return
+	}
+	uc.deletedGroups.remove(group)
+	err := uc.InvalidateDiscoveryGroup(group)
+	if err != nil {
+		fmt.Printf("%+v\n", err)
+	}
+}
+
+// crdDeleted invalidates the cached discovery of the group of
+// a CRD that got deleted. Kinds of this group are no longer
+// discovered again.
+//
+// NOTE:
+//  Group is known again once this client creates, updates or
+// patches one of its CRDs
+func (uc *DynClient) crdDeleted(group string) {
+	if group == "" {
+		return
+	}
+	err := uc.InvalidateDiscoveryGroup(group)
+	if err != nil {
+		fmt.Printf("%+v\n", err)
+	}
+	uc.deletedGroups.add(group)
+}
+
+// groupSet is a set of api groups that is safe for concurrent
+// use
+//
+// NOTE:
+//  A nil set is empty & ignores additions
+type groupSet struct {
+	mu     sync.Mutex
+	groups map[string]bool
+}
+
+// add adds the provided group to this set
+func (s *groupSet) add(group string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.groups == nil {
+		s.groups = map[string]bool{}
+	}
+	s.groups[group] = true
+}
+
+// remove removes the provided group from this set
+func (s *groupSet) remove(group string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.groups, group)
+}
+
+// has returns true if the provided group is in this set
+func (s *groupSet) has(group string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.groups[group]
+}
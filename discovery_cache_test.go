@@ -0,0 +1,251 @@
+package kgetset
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestDiscoveryCacheInvalidatesGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kgetset")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	newServer := func() *fakediscovery.FakeDiscovery {
+		server := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{}}
+		server.Resources = []*metav1.APIResourceList{
+			{
+				GroupVersion: "v1",
+				APIResources: []metav1.APIResource{{Name: "namespaces", Kind: "Namespace"}},
+			},
+			{
+				GroupVersion: "openebs.io/v1",
+				APIResources: []metav1.APIResource{{Name: "hellos", Kind: "Hello", Namespaced: true}},
+			},
+		}
+		return server
+	}
+	discover := func(cache *groupDiscoveryCache, server *fakediscovery.FakeDiscovery) int {
+		before := len(server.Actions())
+		_, lists, err := cache.ServerGroupsAndResources()
+		if err != nil {
+			t.Fatalf("test failed: %+v", err)
+		}
+		if len(lists) != 2 {
+			t.Fatalf("test failed: expected 2 resource lists got %d", len(lists))
+		}
+		return len(server.Actions()) - before
+	}
+
+	server := newServer()
+	cache := newGroupDiscoveryCache(server, "https://10.0.0.1:6443", dir, time.Minute)
+	if got := discover(cache, server); got != 3 {
+		t.Fatalf("test failed: expected 3 discovery calls got %d", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "10.0.0.1_6443", "openebs.io", "v1", "serverresources.json")); err != nil {
+		t.Fatalf("test failed: expected cached file: %v", err)
+	}
+
+	// a later run is served from disk
+	server = newServer()
+	cache = newGroupDiscoveryCache(server, "https://10.0.0.1:6443", dir, time.Minute)
+	if got := discover(cache, server); got != 0 {
+		t.Fatalf("test failed: expected no discovery calls got %d", got)
+	}
+
+	// only the invalidated group & the list of groups are discovered
+	err = cache.invalidateGroup("openebs.io")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if got := discover(cache, server); got != 2 {
+		t.Fatalf("test failed: expected 2 discovery calls got %d", got)
+	}
+
+	cache.Invalidate()
+	if got := discover(cache, server); got != 3 {
+		t.Fatalf("test failed: expected 3 discovery calls after full invalidation got %d", got)
+	}
+
+	// group invalidation does not swallow the next invalidation
+	err = cache.invalidateGroup("openebs.io")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	cache.Invalidate()
+	if got := discover(cache, server); got != 3 {
+		t.Fatalf("test failed: expected 3 discovery calls after full invalidation got %d", got)
+	}
+
+	// another server does not share the cache
+	server = newServer()
+	cache = newGroupDiscoveryCache(server, "https://10.0.0.2:6443", dir, time.Minute)
+	if got := discover(cache, server); got != 3 {
+		t.Fatalf("test failed: expected 3 discovery calls got %d", got)
+	}
+}
+
+func TestGroupDiscoveryRESTMapper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kgetset")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{}}
+	server.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{{Name: "namespaces", Kind: "Namespace"}},
+		},
+		{
+			GroupVersion: "openebs.io/v1",
+			APIResources: []metav1.APIResource{{Name: "hellos", Kind: "Hello", Namespaced: true}},
+		},
+	}
+	cache := newGroupDiscoveryCache(server, "https://10.0.0.1:6443", dir, time.Minute)
+	mapper := newGroupDiscoveryRESTMapper(cache)
+	discover := func() int {
+		before := len(server.Actions())
+		mapping, err := mapper.RESTMapping(schema.GroupKind{Group: "openebs.io", Kind: "Hello"}, "v1")
+		if err != nil {
+			t.Fatalf("test failed: %+v", err)
+		}
+		if mapping.Resource.Resource != "hellos" {
+			t.Fatalf("test failed: expected hellos got %s", mapping.Resource)
+		}
+		return len(server.Actions()) - before
+	}
+
+	if got := discover(); got != 3 {
+		t.Fatalf("test failed: expected 3 discovery calls got %d", got)
+	}
+	if got := discover(); got != 0 {
+		t.Fatalf("test failed: expected no discovery calls got %d", got)
+	}
+
+	// forgetting mappings keeps the cache of other groups
+	err = cache.invalidateGroup("openebs.io")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	mapper.forget()
+	if got := discover(); got != 2 {
+		t.Fatalf("test failed: expected 2 discovery calls got %d", got)
+	}
+
+	// reset on a missing kind discovers everything again
+	mapper.Reset()
+	if got := discover(); got != 3 {
+		t.Fatalf("test failed: expected 3 discovery calls after reset got %d", got)
+	}
+}
+
+func TestPatchedCRDInvalidatesItsGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kgetset")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	client := NewFakeDynClientOrDie(newTestCRD("openebs.io", "hellos", "Hello", nil, nil))
+	server := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{}}
+	server.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "openebs.io/v1",
+			APIResources: []metav1.APIResource{{Name: "hellos", Kind: "Hello", Namespaced: true}},
+		},
+	}
+	client.discoveryCache = newGroupDiscoveryCache(server, "https://10.0.0.1:6443", dir, time.Minute)
+	cached := filepath.Join(client.discoveryCache.dir, "openebs.io")
+	isCached := func() bool {
+		_, err := os.Stat(cached)
+		return err == nil
+	}
+	patch := []byte(`{"metadata":{"labels":{"app":"hello"}}}`)
+
+	_, _, err = client.discoveryCache.ServerGroupsAndResources()
+	if err != nil || !isCached() {
+		t.Fatalf("test failed: expected cached group: %v", err)
+	}
+	_, err = client.Patch(DryRunContext(ctx), crdGVK, "", "hellos.openebs.io", types.MergePatchType, patch)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if !isCached() {
+		t.Fatalf("test failed: expected dry run patch to keep the cached group")
+	}
+	_, err = client.Patch(ctx, crdGVK, "", "hellos.openebs.io", types.MergePatchType, patch)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if isCached() {
+		t.Fatalf("test failed: expected patched crd to invalidate its group")
+	}
+}
+
+// noMatchRESTMapper knows no kinds & counts its resets
+type noMatchRESTMapper struct {
+	meta.RESTMapper
+	resets int
+}
+
+// Reset implements resettableRESTMapper interface
+func (m *noMatchRESTMapper) Reset() {
+	m.resets++
+}
+
+func TestDeletedCRDGroupIsNotDiscoveredAgain(t *testing.T) {
+	ctx := context.Background()
+	crd := newTestCRD("openebs.io", "hellos", "Hello", nil, nil)
+	client := NewFakeDynClientOrDie(crd)
+	err := client.Delete(ctx, crdGVK, "", crd.GetName(), nil)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+
+	// kinds are no longer served once their crd is gone
+	fakeMapper := client.mapper
+	mapper := &noMatchRESTMapper{RESTMapper: meta.NewDefaultRESTMapper(nil)}
+	client.mapper = mapper
+	client.mapperBackoff = wait.Backoff{Duration: 200 * time.Millisecond, Steps: 2}
+
+	start := time.Now()
+	_, err = client.RESTMapping(schema.GroupVersionKind{Group: "openebs.io", Version: "v1", Kind: "Hello"})
+	if !meta.IsNoMatchError(errors.Cause(err)) {
+		t.Fatalf("test failed: expected no match error got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond || mapper.resets != 0 {
+		t.Fatalf("test failed: expected no rediscovery got %s & %d resets", elapsed, mapper.resets)
+	}
+	// kinds of other groups are discovered again
+	_, err = client.RESTMapping(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Hello"})
+	if !meta.IsNoMatchError(errors.Cause(err)) || mapper.resets == 0 {
+		t.Fatalf("test failed: expected rediscovery got %v & %d resets", err, mapper.resets)
+	}
+
+	// group is discovered again once its crd is created
+	client.mapper = fakeMapper
+	_, err = client.Create(ctx, crdGVK, "", crd)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if client.deletedGroups.has("openebs.io") {
+		t.Fatalf("test failed: expected group to be discovered again")
+	}
+}
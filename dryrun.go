@@ -0,0 +1,57 @@
+package kgetset
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// dryRunKey is the context key that marks api calls as dry run
+type dryRunKey struct{}
+
+// DryRunContext returns a copy of the provided context whose
+// mutating api calls i.e. create, update, patch & delete are
+// made in dry run mode
+//
+// NOTE:
+//  K8s validates, defaults & admits dry run requests & returns
+// the resulting object without persisting it
+func DryRunContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// WithDryRun makes all the mutating api calls of the client
+// dry run
+func WithDryRun() func(*DynClientConfig) {
+	return func(c *DynClientConfig) {
+		c.DryRun = true
+	}
+}
+
+// DryRun returns a new client whose mutating api calls are
+// made in dry run mode. The new client shares everything else
+// with this client.
+func (uc *DynClient) DryRun() *DynClient {
+	derived := uc.derive()
+	derived.dryRun = true
+	return derived
+}
+
+// IsDryRun returns true if mutating api calls made with the
+// provided context are dry run
+func (uc *DynClient) IsDryRun(ctx context.Context) bool {
+	if uc.dryRun {
+		return true
+	}
+	dryRun, _ := ctx.Value(dryRunKey{}).(bool)
+	return dryRun
+}
+
+// dryRunOption returns the dry run option to be sent with a
+// mutating api call made with the provided context
+func (uc *DynClient) dryRunOption(ctx context.Context) []string {
+	if !uc.IsDryRun(ctx) {
+		return nil
+	}
+	return []string{metav1.DryRunAll}
+}
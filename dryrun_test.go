@@ -0,0 +1,145 @@
+package kgetset
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+)
+
+// TestDryRunRequests verifies the dry run option sent with the
+// mutating api calls of DynClient
+//
+// NOTE:
+//  K8s does not persist dry run requests. This is verified
+// against a real cluster.
+func TestDryRunRequests(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	handle := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := ioutil.ReadAll(r.Body)
+		dryRun := r.URL.Query()["dryRun"]
+		if r.Method == http.MethodDelete {
+			// delete options are sent as body
+			options := metav1.DeleteOptions{}
+			_ = json.Unmarshal(body, &options)
+			dryRun = options.DryRun
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/apis/openebs.io/v1/namespaces/default/hellos")
+		calls = append(calls, r.Method+" "+strings.TrimPrefix(name, "/")+" "+strings.Join(dryRun, ","))
+
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/no-hello"):
+			writeNotFound(w)
+		case r.Method == http.MethodDelete:
+			writeJSON(w, metav1.Status{Status: metav1.StatusSuccess})
+		case r.Method == http.MethodPatch:
+			writeJSON(w, newTestHello("my-hello", "bye").Object)
+		default:
+			// created & updated objects are returned as is
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(body)
+		}
+	}
+	server := newTestServer(map[string]http.HandlerFunc{
+		"/apis/openebs.io/v1/namespaces/default/hellos":  handle,
+		"/apis/openebs.io/v1/namespaces/default/hellos/": handle,
+	})
+	defer server.Close()
+
+	client, err := NewDynClientForConfig(
+		&rest.Config{Host: server.URL},
+		WithRetryPolicy(NoRetryPolicy),
+	)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	ctx := context.Background()
+	gvk := schema.GroupVersionKind{Group: "openebs.io", Version: "v1", Kind: "Hello"}
+
+	_, err = client.Create(ctx, gvk, "default", newTestHello("my-hello", "hi"))
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+
+	// per call dry run
+	dryCtx := DryRunContext(ctx)
+	created, err := client.Create(dryCtx, gvk, "default", newTestHello("new-hello", "hi"))
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if created.GetName() != "new-hello" {
+		t.Fatalf("test failed: expected response for new-hello got %q", created.GetName())
+	}
+	_, err = client.Update(dryCtx, gvk, "default", newTestHello("my-hello", "bye"))
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+
+	// client wide dry run
+	dry := client.DryRun()
+	_, err = dry.Patch(
+		ctx, gvk, "default", "my-hello",
+		types.MergePatchType, []byte(`{"spec":{"desc":"bye"}}`),
+	)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	err = dry.Delete(ctx, gvk, "default", "my-hello", nil)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	err = dry.Delete(ctx, gvk, "default", "no-hello", nil)
+	if !k8serrors.IsNotFound(err) {
+		t.Fatalf("test failed: expected not found got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{
+		"POST  ",
+		"POST  All",
+		"PUT my-hello All",
+		"PATCH my-hello All",
+		"DELETE my-hello All",
+		"DELETE no-hello All",
+	}
+	if strings.Join(calls, "; ") != strings.Join(expected, "; ") {
+		t.Fatalf("test failed: expected calls %q got %q", expected, calls)
+	}
+
+	var dryRuns int
+	for _, e := range client.Transcript().Entries() {
+		if e.DryRun {
+			dryRuns++
+		}
+	}
+	if dryRuns != 5 {
+		t.Fatalf("test failed: expected 5 dry run entries got %d", dryRuns)
+	}
+}
+
+// newTestHello returns a Hello in the default namespace with
+// the provided name & desc
+func newTestHello(name, desc string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "openebs.io/v1",
+			"kind":       "Hello",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+			"spec":       map[string]interface{}{"desc": desc},
+		},
+	}
+}
@@ -0,0 +1,415 @@
+package kgetset
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	apiversion "k8s.io/apimachinery/pkg/version"
+	"k8s.io/apimachinery/pkg/watch"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// fakeRESTMapper is a static RESTMapper whose kinds are seeded
+// from CustomResourceDefinitions
+type fakeRESTMapper struct {
+	*meta.DefaultRESTMapper
+
+	// discovery serves the api resources known to this mapper
+	discovery *fakediscovery.FakeDiscovery
+}
+
+// addResource makes the provided api resource known to this
+// mapper & its discovery
+func (m *fakeRESTMapper) addResource(gv schema.GroupVersion, res metav1.APIResource) {
+	scope := meta.RESTScopeNamespace
+	if !res.Namespaced {
+		scope = meta.RESTScopeRoot
+	}
+	m.AddSpecific(
+		gv.WithKind(res.Kind),
+		gv.WithResource(res.Name),
+		gv.WithResource(res.SingularName),
+		scope,
+	)
+	m.addDiscovery(gv, res)
+}
+
+// addDiscovery makes the provided api resource known to the
+// discovery of this mapper
+func (m *fakeRESTMapper) addDiscovery(gv schema.GroupVersion, res metav1.APIResource) {
+	m.discovery.Lock()
+	defer m.discovery.Unlock()
+	for _, list := range m.discovery.Resources {
+		if list.GroupVersion == gv.String() {
+			list.APIResources = append(list.APIResources, res)
+			return
+		}
+	}
+	m.discovery.Resources = append(
+		m.discovery.Resources,
+		&metav1.APIResourceList{
+			GroupVersion: gv.String(),
+			APIResources: []metav1.APIResource{res},
+		},
+	)
+}
+
+// Reset is a no-op since mappings of a static mapper are
+// never discovered
+func (m *fakeRESTMapper) Reset() {}
+
+// addCRD makes the kinds of the provided CustomResourceDefinition
+// known to this mapper
+func (m *fakeRESTMapper) addCRD(crd *unstructured.Unstructured) error {
+	group, _, err := unstructured.NestedString(crd.Object, "spec", "group")
+	if err != nil {
+		return err
+	}
+	names, _, err := unstructured.NestedMap(crd.Object, "spec", "names")
+	if err != nil {
+		return err
+	}
+	kind, _ := names["kind"].(string)
+	plural, _ := names["plural"].(string)
+	singular, _ := names["singular"].(string)
+	scope, _, err := unstructured.NestedString(crd.Object, "spec", "scope")
+	if err != nil {
+		return err
+	}
+	versions, err := crdVersions(crd)
+	if err != nil {
+		return err
+	}
+	if group == "" || kind == "" || plural == "" || len(versions) == 0 {
+		return errors.Errorf(
+			"failed to add crd %q to fake mapper: missing group, versions or names",
+			crd.GetName(),
+		)
+	}
+
+	if singular == "" {
+		singular = strings.ToLower(kind)
+	}
+	res := metav1.APIResource{
+		Name:         plural,
+		SingularName: singular,
+		Namespaced:   scope != "Cluster",
+		Kind:         kind,
+		Verbs:        fakeVerbs,
+		ShortNames:   toStrings(names["shortNames"]),
+		Categories:   toStrings(names["categories"]),
+	}
+	for _, version := range versions {
+		m.addResource(schema.GroupVersion{Group: group, Version: version}, res)
+	}
+	return nil
+}
+
+// fakeVerbs are the verbs supported by fake api resources
+var fakeVerbs = metav1.Verbs{
+	"create", "delete", "get", "list", "patch", "update", "watch",
+}
+
+// toStrings returns the strings of the provided json list
+func toStrings(val interface{}) []string {
+	list, _ := val.([]interface{})
+	var strs []string
+	for _, item := range list {
+		if str, ok := item.(string); ok {
+			strs = append(strs, str)
+		}
+	}
+	return strs
+}
+
+// crdVersions returns the versions served by the provided
+// CustomResourceDefinition
+func crdVersions(crd *unstructured.Unstructured) ([]string, error) {
+	var versions []string
+	version, _, err := unstructured.NestedString(crd.Object, "spec", "version")
+	if err != nil {
+		return nil, err
+	}
+	if version != "" {
+		versions = append(versions, version)
+	}
+	list, _, err := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range list {
+		v, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := v["name"].(string)
+		if name != "" && name != version {
+			versions = append(versions, name)
+		}
+	}
+	return versions, nil
+}
+
+// establishCRD marks the provided CustomResourceDefinition as
+// established the way K8s does once its names are accepted
+func establishCRD(crd *unstructured.Unstructured) error {
+	return unstructured.SetNestedSlice(
+		crd.Object,
+		[]interface{}{
+			map[string]interface{}{"type": "NamesAccepted", "status": "True"},
+			map[string]interface{}{"type": "Established", "status": "True"},
+		},
+		"status",
+		"conditions",
+	)
+}
+
+// newFakeUID returns an uid for a fake object
+func newFakeUID() types.UID {
+	return types.UID("fake-" + rand.String(16))
+}
+
+// isCRD returns true if the provided object is a
+// CustomResourceDefinition
+func isCRD(obj *unstructured.Unstructured) bool {
+	return obj.GroupVersionKind().GroupKind() == crdGVK.GroupKind()
+}
+
+// NewFakeDynClient returns a DynClient that works against an
+// in-memory object tracker instead of a K8s cluster. This lets
+// suites be unit tested without a cluster.
+//
+// NOTE:
+//  Kinds of the provided CustomResourceDefinitions as well as
+// those created later via this client are made known to a
+// static RESTMapper. These CustomResourceDefinitions are
+// established right away & their custom resources are deleted
+// along with them. Created objects are assigned an uid.
+//
+// Dry run, finalizers, garbage collection & subresources are
+// not emulated. These are verified against the requests sent
+// to an api server instead.
+func NewFakeDynClient(objects ...*unstructured.Unstructured) (*DynClient, error) {
+	mapper := &fakeRESTMapper{
+		DefaultRESTMapper: meta.NewDefaultRESTMapper(
+			[]schema.GroupVersion{
+				{Group: crdGVK.Group, Version: "v1beta1"},
+				{Group: "", Version: "v1"},
+			},
+		),
+		discovery: &fakediscovery.FakeDiscovery{
+			Fake:               &clienttesting.Fake{},
+			FakedServerVersion: FakeServerVersion,
+		},
+	}
+	for _, version := range []string{"v1beta1", "v1"} {
+		mapper.addResource(
+			schema.GroupVersion{Group: crdGVK.Group, Version: version},
+			metav1.APIResource{
+				Name:         "customresourcedefinitions",
+				SingularName: "customresourcedefinition",
+				Kind:         crdGVK.Kind,
+				Verbs:        fakeVerbs,
+				ShortNames:   []string{"crd", "crds"},
+			},
+		)
+	}
+	mapper.addResource(
+		schema.GroupVersion{Version: "v1"},
+		metav1.APIResource{
+			Name:         "namespaces",
+			SingularName: "namespace",
+			Kind:         "Namespace",
+			Verbs:        fakeVerbs,
+			ShortNames:   []string{"ns"},
+		},
+	)
+
+	scheme := runtime.NewScheme()
+	dyn := dynamicfake.NewSimpleDynamicClient(scheme)
+
+	// objects are stored in a tracker of its own that reactors
+	// can read from
+	tracker := clienttesting.NewObjectTracker(
+		scheme,
+		serializer.NewCodecFactory(scheme).UniversalDecoder(),
+	)
+	for _, o := range objects {
+		obj, err := toJSONObject(o.UnstructuredContent())
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to seed fake client with %q", o.GetName())
+		}
+		seed := &unstructured.Unstructured{Object: obj}
+		if seed.GetUID() == "" {
+			seed.SetUID(newFakeUID())
+		}
+		if isCRD(seed) {
+			err = mapper.addCRD(seed)
+			if err != nil {
+				return nil, err
+			}
+			err = establishCRD(seed)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = tracker.Add(seed)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to seed fake client with %q", o.GetName())
+		}
+	}
+
+	dyn.PrependWatchReactor(
+		"*",
+		func(action clienttesting.Action) (bool, watch.Interface, error) {
+			w, err := tracker.Watch(action.GetResource(), action.GetNamespace())
+			return true, w, err
+		},
+	)
+	dyn.PrependReactor("*", "*", clienttesting.ObjectReaction(tracker))
+	dyn.PrependReactor(
+		"create",
+		"*",
+		func(action clienttesting.Action) (bool, runtime.Object, error) {
+			create := action.(clienttesting.CreateAction)
+			obj, ok := create.GetObject().(*unstructured.Unstructured)
+			if !ok || action.GetSubresource() != "" || obj.GetUID() != "" {
+				return false, nil, nil
+			}
+			// objects are assigned an uid the way K8s does
+			obj = obj.DeepCopy()
+			obj.SetUID(newFakeUID())
+			err := tracker.Create(action.GetResource(), obj, action.GetNamespace())
+			if err != nil {
+				return true, nil, err
+			}
+			return true, obj, nil
+		},
+	)
+	dyn.PrependReactor(
+		"delete",
+		"customresourcedefinitions",
+		func(action clienttesting.Action) (bool, runtime.Object, error) {
+			name := action.(clienttesting.DeleteAction).GetName()
+			_, err := tracker.Get(action.GetResource(), "", name)
+			if err != nil {
+				// let the object tracker report it
+				return false, nil, nil
+			}
+			err = deleteCustomResources(tracker, mapper, name)
+			if err != nil {
+				return true, nil, err
+			}
+			// let the object tracker delete the crd
+			return false, nil, nil
+		},
+	)
+	dyn.PrependReactor(
+		"create",
+		"customresourcedefinitions",
+		func(action clienttesting.Action) (bool, runtime.Object, error) {
+			crd, ok := action.(clienttesting.CreateAction).GetObject().(*unstructured.Unstructured)
+			if !ok {
+				return false, nil, nil
+			}
+			err := mapper.addCRD(crd)
+			if err != nil {
+				return true, nil, err
+			}
+			err = establishCRD(crd)
+			if err != nil {
+				return true, nil, err
+			}
+			// let the object tracker store the established crd
+			return false, nil, nil
+		},
+	)
+
+	return &DynClient{
+		dynamic:   dyn,
+		mapper:    mapper,
+		discovery: mapper.discovery,
+		// static mappings are never discovered again
+		mapperBackoff: wait.Backoff{Steps: 1},
+		timeout:       DefaultTimeout,
+		retryPolicy:   DefaultRetryPolicy,
+		transcript:    &Transcript{},
+		deletedGroups: &groupSet{},
+	}, nil
+}
+
+// fakeListGVK is the list kind registered by the fake dynamic
+// client. It lists objects of any kind.
+var fakeListGVK = schema.GroupVersionKind{
+	Group:   "fake-dynamic-client-group",
+	Version: "v1",
+}
+
+// deleteCustomResources deletes the custom resources of the
+// CRD with the provided name the way K8s does once the CRD is
+// deleted
+func deleteCustomResources(
+	tracker clienttesting.ObjectTracker,
+	mapper *fakeRESTMapper,
+	crdName string,
+) error {
+	gvrs, err := mapper.ResourcesFor(
+		schema.GroupVersionResource{
+			Group:    crdGroupOf(crdName),
+			Resource: strings.SplitN(crdName, ".", 2)[0],
+		},
+	)
+	if err != nil {
+		// crd of unknown kinds has no custom resources
+		return nil
+	}
+	for _, gvr := range gvrs {
+		obj, err := tracker.List(gvr, fakeListGVK, "")
+		if err != nil {
+			return err
+		}
+		list, err := meta.ExtractList(obj)
+		if err != nil {
+			return err
+		}
+		for _, item := range list {
+			o, err := meta.Accessor(item)
+			if err != nil {
+				return err
+			}
+			err = tracker.Delete(gvr, o.GetNamespace(), o.GetName())
+			if err != nil && !k8serrors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FakeServerVersion is the version served by fake clients
+var FakeServerVersion = &apiversion.Info{
+	Major:      "1",
+	Minor:      "15",
+	GitVersion: "v1.15.0",
+}
+
+// NewFakeDynClientOrDie returns a fake DynClient or panics
+func NewFakeDynClientOrDie(objects ...*unstructured.Unstructured) *DynClient {
+	d, err := NewFakeDynClient(objects...)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
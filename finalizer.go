@@ -0,0 +1,306 @@
+package kgetset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// AddFinalizer adds the provided finalizer to the object with
+// the provided name if it does not have it already
+func (uc *DynClient) AddFinalizer(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	finalizer string,
+) (*unstructured.Unstructured, error) {
+	return uc.updateFinalizers(ctx, gvk, namespace, name, func(finalizers []string) []string {
+		for _, f := range finalizers {
+			if f == finalizer {
+				return finalizers
+			}
+		}
+		return append(finalizers, finalizer)
+	})
+}
+
+// RemoveFinalizer removes the provided finalizer from the
+// object with the provided name
+func (uc *DynClient) RemoveFinalizer(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	finalizer string,
+) (*unstructured.Unstructured, error) {
+	return uc.updateFinalizers(ctx, gvk, namespace, name, func(finalizers []string) []string {
+		var kept []string
+		for _, f := range finalizers {
+			if f != finalizer {
+				kept = append(kept, f)
+			}
+		}
+		return kept
+	})
+}
+
+// RemoveAllFinalizers removes every finalizer of the object
+// with the provided name
+//
+// NOTE:
+//  This lets K8s delete the object without waiting for its
+// controllers to clean up. Use this in teardown only.
+func (uc *DynClient) RemoveAllFinalizers(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+) (*unstructured.Unstructured, error) {
+	return uc.updateFinalizers(ctx, gvk, namespace, name, func([]string) []string {
+		return nil
+	})
+}
+
+// updateFinalizers sets the finalizers returned by the provided
+// function against the object with the provided name
+func (uc *DynClient) updateFinalizers(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	fn func(finalizers []string) []string,
+) (*unstructured.Unstructured, error) {
+	return uc.updateObject(ctx, gvk, namespace, name, func(obj *unstructured.Unstructured) (bool, error) {
+		finalizers := fn(append([]string(nil), obj.GetFinalizers()...))
+		if equalStrings(finalizers, obj.GetFinalizers()) {
+			return false, nil
+		}
+		obj.SetFinalizers(finalizers)
+		return true, nil
+	})
+}
+
+// equalStrings returns true if the provided lists are equal
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// DeletionDiagnosis lists what keeps an object from being
+// deleted
+type DeletionDiagnosis struct {
+	// DeletionTimestamp is nil if deletion was never requested
+	DeletionTimestamp *metav1.Time
+
+	// Finalizers must be removed by their controllers before
+	// K8s deletes the object
+	Finalizers []string
+
+	// OwnerReferences of the object. An owner deleted in
+	// foreground waits for its dependents to be deleted.
+	OwnerReferences []metav1.OwnerReference
+}
+
+// NewDeletionDiagnosis returns the deletion diagnosis of the
+// provided object
+func NewDeletionDiagnosis(obj *unstructured.Unstructured) DeletionDiagnosis {
+	return DeletionDiagnosis{
+		DeletionTimestamp: obj.GetDeletionTimestamp(),
+		Finalizers:        obj.GetFinalizers(),
+		OwnerReferences:   obj.GetOwnerReferences(),
+	}
+}
+
+// String implements Stringer interface
+func (d DeletionDiagnosis) String() string {
+	var msgs []string
+	if d.DeletionTimestamp == nil {
+		msgs = append(msgs, "deletion not requested")
+	} else {
+		msgs = append(
+			msgs,
+			fmt.Sprintf("deletion requested at %s", d.DeletionTimestamp.UTC().Format(time.RFC3339)),
+		)
+	}
+	if len(d.Finalizers) != 0 {
+		msgs = append(msgs, fmt.Sprintf("finalizers [%s]", strings.Join(d.Finalizers, " ")))
+	}
+	if len(d.OwnerReferences) != 0 {
+		var owners []string
+		for _, ref := range d.OwnerReferences {
+			owner := fmt.Sprintf("%s/%s", ref.Kind, ref.Name)
+			if ref.BlockOwnerDeletion != nil && *ref.BlockOwnerDeletion {
+				owner += " (blocks owner deletion)"
+			}
+			owners = append(owners, owner)
+		}
+		msgs = append(msgs, fmt.Sprintf("owner references [%s]", strings.Join(owners, " ")))
+	}
+	return strings.Join(msgs, ": ")
+}
+
+// WaitForDeletion waits till the object with the provided name
+// is no longer found at K8s
+//
+// NOTE:
+//  If the object is still found after the wait, its deletion
+// timestamp, finalizers & owner references are printed &
+// returned as part of the error
+func (uc *DynClient) WaitForDeletion(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	options ...func(*WaitConfig),
+) error {
+	err := WaitFor(ctx, uc.Deleted(gvk, namespace, name), options...)
+	if err == nil {
+		return nil
+	}
+	return uc.diagnoseDeletion(ctx, gvk, namespace, name, err)
+}
+
+// diagnoseDeletion returns the provided error of waiting for
+// the deletion of the provided object along with the reason
+// why the object is not yet deleted
+func (uc *DynClient) diagnoseDeletion(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	err error,
+) error {
+	ctx, cancel := uc.followUpContext(ctx)
+	defer cancel()
+	obj, getErr := uc.Get(ctx, gvk, namespace, name)
+	if getErr != nil {
+		if k8serrors.IsNotFound(errors.Cause(getErr)) {
+			return nil
+		}
+		return errors.Wrapf(err, "failed to wait for deletion of %s %q", gvk.Kind, name)
+	}
+	diagnosis := NewDeletionDiagnosis(obj)
+	fmt.Printf("%s %q is not deleted: %s\n", gvk.Kind, name, diagnosis)
+	return errors.Wrapf(
+		err,
+		"failed to wait for deletion of %s %q: %s",
+		gvk.Kind,
+		name,
+		diagnosis,
+	)
+}
+
+// followUpContext returns the context of api calls that follow
+// a wait e.g. to diagnose a deletion that did not complete
+//
+// NOTE:
+//  A provided context that is done is replaced with a fresh
+// one bounded by the client's timeout. Otherwise the follow up
+// calls would fail with the error of the expired context.
+func (uc *DynClient) followUpContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx.Err() == nil {
+		return context.WithCancel(ctx)
+	}
+	timeout := uc.timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// DeletionConfig is used to delete an object & wait for it to
+// be gone
+type DeletionConfig struct {
+	// DeleteOptions are sent with the delete call
+	DeleteOptions *metav1.DeleteOptions
+
+	// WaitOptions are used to wait for the deletion
+	WaitOptions []func(*WaitConfig)
+
+	// ForceFinalize removes the finalizers of an object whose
+	// deletion did not complete in time & waits again
+	ForceFinalize bool
+}
+
+// WithDeleteOptions sets the options sent with the delete call
+func WithDeleteOptions(options *metav1.DeleteOptions) func(*DeletionConfig) {
+	return func(c *DeletionConfig) {
+		c.DeleteOptions = options
+	}
+}
+
+// WithDeletionWait sets the options used to wait for the
+// deletion
+func WithDeletionWait(options ...func(*WaitConfig)) func(*DeletionConfig) {
+	return func(c *DeletionConfig) {
+		c.WaitOptions = append(c.WaitOptions, options...)
+	}
+}
+
+// WithForceFinalize removes the finalizers of an object whose
+// deletion did not complete in time
+func WithForceFinalize() func(*DeletionConfig) {
+	return func(c *DeletionConfig) {
+		c.ForceFinalize = true
+	}
+}
+
+// DeleteAndWait deletes the object with the provided name &
+// waits till it is no longer found at K8s. An object that is
+// already deleted is not an error.
+//
+// NOTE:
+//  With force finalize the object's controllers do not get to
+// clean up. This is meant for teardown of test fixtures.
+func (uc *DynClient) DeleteAndWait(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	options ...func(*DeletionConfig),
+) error {
+	c := &DeletionConfig{}
+	for _, o := range options {
+		o(c)
+	}
+
+	err := uc.Delete(ctx, gvk, namespace, name, c.DeleteOptions)
+	if k8serrors.IsNotFound(errors.Cause(err)) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = uc.WaitForDeletion(ctx, gvk, namespace, name, c.WaitOptions...)
+	if err == nil || !c.ForceFinalize {
+		return err
+	}
+
+	// wait may have used up the provided context
+	ctx, cancel := uc.followUpContext(ctx)
+	defer cancel()
+	fmt.Printf("removing finalizers of %s %q\n", gvk.Kind, name)
+	_, ferr := uc.RemoveAllFinalizers(ctx, gvk, namespace, name)
+	if k8serrors.IsNotFound(errors.Cause(ferr)) {
+		return nil
+	}
+	if ferr != nil {
+		return errors.Wrapf(ferr, "failed to force finalize %s %q: %v", gvk.Kind, name, err)
+	}
+	return uc.WaitForDeletion(ctx, gvk, namespace, name, c.WaitOptions...)
+}
@@ -0,0 +1,244 @@
+package kgetset
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// stuckNamespace serves the namespace my-ns whose deletion
+// completes only once it has no finalizers. Its mutating
+// requests are recorded.
+type stuckNamespace struct {
+	mu         sync.Mutex
+	finalizers []string
+	deletedAt  string
+	gone       bool
+	calls      []string
+}
+
+// ServeHTTP implements http.Handler
+func (s *stuckNamespace) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodDelete:
+		s.calls = append(s.calls, "DELETE")
+		if s.deletedAt == "" {
+			s.deletedAt = time.Now().UTC().Format(time.RFC3339)
+		}
+	case http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		obj := &unstructured.Unstructured{}
+		_ = obj.UnmarshalJSON(body)
+		s.finalizers = obj.GetFinalizers()
+		s.calls = append(s.calls, fmt.Sprintf("PUT %v", s.finalizers))
+	}
+	if s.gone || (s.deletedAt != "" && len(s.finalizers) == 0) {
+		s.gone = true
+		writeNotFound(w)
+		return
+	}
+	metadata := map[string]interface{}{"name": "my-ns", "finalizers": s.finalizers}
+	if s.deletedAt != "" {
+		metadata["deletionTimestamp"] = s.deletedAt
+	}
+	writeJSON(w, map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata":   metadata,
+	})
+}
+
+// newStuckNamespaceClient returns a client of the returned api
+// server that serves the provided stuck namespace
+func newStuckNamespaceClient(t *testing.T, ns *stuckNamespace) (*DynClient, *httptest.Server) {
+	server := newTestServer(map[string]http.HandlerFunc{
+		"/api/v1/namespaces/my-ns": ns.ServeHTTP,
+	})
+	client, err := NewDynClientForConfig(
+		&rest.Config{Host: server.URL},
+		WithRetryPolicy(NoRetryPolicy),
+	)
+	if err != nil {
+		server.Close()
+		t.Fatalf("test failed: %+v", err)
+	}
+	return client, server
+}
+
+func TestStuckDeletionIsDiagnosedAfterContextExpires(t *testing.T) {
+	ns := &stuckNamespace{finalizers: []string{"openebs.io/a"}}
+	client, server := newStuckNamespaceClient(t, ns)
+	defer server.Close()
+	interval := WithDeletionWait(WithWaitInterval(10 * time.Millisecond))
+
+	// wait times out with the provided context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := client.DeleteAndWait(ctx, namespaceGVK, "", "my-ns", interval)
+	if ctx.Err() == nil {
+		t.Fatalf("test failed: expected context to expire")
+	}
+	if err == nil || !strings.Contains(err.Error(), "finalizers [openebs.io/a]") {
+		t.Fatalf("test failed: expected diagnosis got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = client.DeleteAndWait(ctx, namespaceGVK, "", "my-ns", interval, WithForceFinalize())
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+
+	// finalizers are removed once the deletion got stuck again
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	expected := []string{"DELETE", "DELETE", "PUT []"}
+	if strings.Join(ns.calls, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("test failed: expected calls %v got %v", expected, ns.calls)
+	}
+}
+
+func TestAddFinalizerRetriesConflicts(t *testing.T) {
+	var tests = map[string]struct {
+		policy    RetryPolicy
+		conflicts int
+		updates   int
+		isErr     bool
+	}{
+		"zero policy": {
+			policy:  RetryPolicy{},
+			updates: 1,
+		},
+		"zero policy with conflict": {
+			policy:    RetryPolicy{},
+			conflicts: 1,
+			updates:   1,
+			isErr:     true,
+		},
+		"conflicts within attempts": {
+			policy:    RetryPolicy{Backoff: wait.Backoff{Steps: 3}},
+			conflicts: 2,
+			updates:   3,
+		},
+		"conflicts exceed attempts": {
+			policy:    RetryPolicy{Backoff: wait.Backoff{Steps: 3}},
+			conflicts: 5,
+			updates:   3,
+			isErr:     true,
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			client := NewFakeDynClientOrDie()
+			client.retryPolicy = mock.policy
+			ns := &unstructured.Unstructured{}
+			ns.SetAPIVersion("v1")
+			ns.SetKind("Namespace")
+			ns.SetName("my-ns")
+			_, err := client.Create(ctx, namespaceGVK, "", ns)
+			if err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+			var updates int
+			client.dynamic.(*dynamicfake.FakeDynamicClient).PrependReactor(
+				"update",
+				"namespaces",
+				func(clienttesting.Action) (bool, runtime.Object, error) {
+					updates++
+					if updates > mock.conflicts {
+						return false, nil, nil
+					}
+					return true, nil, k8serrors.NewConflict(
+						schema.GroupResource{Resource: "namespaces"},
+						"my-ns",
+						errors.New("modified"),
+					)
+				},
+			)
+			_, err = client.AddFinalizer(ctx, namespaceGVK, "", "my-ns", "openebs.io/a")
+			if mock.isErr && !k8serrors.IsConflict(errors.Cause(err)) {
+				t.Fatalf("test failed: expected conflict got %v", err)
+			}
+			if !mock.isErr && err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+			if updates != mock.updates {
+				t.Fatalf("test failed: expected %d updates got %d", mock.updates, updates)
+			}
+			got, err := client.Get(ctx, namespaceGVK, "", "my-ns")
+			if err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+			added := len(got.GetFinalizers()) == 1
+			if added == mock.isErr {
+				t.Fatalf("test failed: expected finalizer added %t got %v", !mock.isErr, got.GetFinalizers())
+			}
+		})
+	}
+}
+
+func TestStuckDeletionIsDiagnosed(t *testing.T) {
+	ctx := context.Background()
+	ns := &stuckNamespace{finalizers: []string{"openebs.io/a", "openebs.io/b"}}
+	client, server := newStuckNamespaceClient(t, ns)
+	defer server.Close()
+
+	shortWait := WithDeletionWait(
+		WithWaitTimeout(50*time.Millisecond),
+		WithWaitInterval(10*time.Millisecond),
+	)
+	err := client.DeleteAndWait(ctx, namespaceGVK, "", "my-ns", shortWait)
+	if err == nil {
+		t.Fatalf("test failed: expected stuck deletion got nil")
+	}
+	for _, expected := range []string{"deletion requested at", "finalizers [openebs.io/a openebs.io/b]"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("test failed: expected %q in %q", expected, err.Error())
+		}
+	}
+
+	// removing one of the finalizers does not complete the deletion
+	_, err = client.RemoveFinalizer(ctx, namespaceGVK, "", "my-ns", "openebs.io/a")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	err = client.WaitForDeletion(
+		ctx, namespaceGVK, "", "my-ns",
+		WithWaitTimeout(50*time.Millisecond), WithWaitInterval(10*time.Millisecond),
+	)
+	if err == nil || !strings.Contains(err.Error(), "finalizers [openebs.io/b]") {
+		t.Fatalf("test failed: expected stuck deletion due to openebs.io/b got %v", err)
+	}
+
+	err = client.DeleteAndWait(ctx, namespaceGVK, "", "my-ns", shortWait, WithForceFinalize())
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	expected := []string{"DELETE", "PUT [openebs.io/b]", "DELETE", "PUT []"}
+	if strings.Join(ns.calls, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("test failed: expected calls %v got %v", expected, ns.calls)
+	}
+}
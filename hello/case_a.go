@@ -1,23 +1,29 @@
 package hello
 
 import (
+	"context"
+
 	k8s "github.com/AmitKumarDas/kgetset"
 	"github.com/AmitKumarDas/kgetset/unstruct"
 	"github.com/pkg/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/client-go/dynamic"
 )
 
 type TestA struct {
+	// runID identifies the run this test is part of
+	runID string
+
+	// crd fixture that is rewritten for this run
+	crd *unstructured.Unstructured
+
 	// crd definition given to cluster
 	input *unstructured.Unstructured
 
 	// crd definition fetched from cluster
 	output *unstructured.Unstructured
 
-	client            *k8s.DynClient
-	resourceInterface dynamic.ResourceInterface
+	client *k8s.DynClient
 
 	k8s.TestAbstract
 }
@@ -25,10 +31,28 @@ type TestA struct {
 // compile time check if TestA implements Testsuite
 var _ k8s.Testsuite = &TestA{}
 
+// WithClient sets the client used by the test e.g. a
+// fake client for unit testing
+func WithClient(client *k8s.DynClient) func(*TestA) {
+	return func(c *TestA) {
+		c.client = client
+	}
+}
+
+// WithRunID sets the id of the run this test is part of
+func WithRunID(runID string) func(*TestA) {
+	return func(c *TestA) {
+		c.runID = runID
+	}
+}
+
 func NewTestA(options ...func(*TestA)) *TestA {
 	c := &TestA{
-		input:  crdInst,
-		client: k8s.NewDynClientOrDie(),
+		crd: crdInst,
+	}
+	// v1beta1 CRDs are not served by K8s 1.22 onwards
+	c.Requires = k8s.Requirements{
+		APIGroupVersions: []string{crdInst.GetAPIVersion()},
 	}
 
 	c.Setupfn = c.setup
@@ -39,37 +63,41 @@ func NewTestA(options ...func(*TestA)) *TestA {
 		o(c)
 	}
 
-	return c
-}
-
-func (c *TestA) getResourceInterfaceOrDie() dynamic.ResourceInterface {
-	if c.resourceInterface != nil {
-		return c.resourceInterface
+	if c.client == nil {
+		c.client = k8s.NewDynClientOrDie()
 	}
-
-	ri, err := c.client.GetResourceInterface(
-		c.input.GroupVersionKind(),
-		c.input.GetNamespace(),
-	)
-	if err != nil {
-		panic(err)
+	if c.runID == "" {
+		c.runID = k8s.NewRunID()
 	}
+	c.Observers = append(c.Observers, c.client)
 
-	c.resourceInterface = ri
-	return ri
+	return c
 }
 
 func (c *TestA) setup() (err error) {
-	ri := c.getResourceInterfaceOrDie()
+	ctx := context.Background()
+
+	// crd is cluster scoped & hence serves a group of its own
+	// per run to avoid collisions with concurrent runs
+	c.input, err = k8s.RunCRD(c.crd, c.runID)
+	if err != nil {
+		return err
+	}
+	gvk := c.input.GroupVersionKind()
 
-	// create at K8s
-	_, err = ri.Create(c.input, metav1.CreateOptions{})
+	// apply at K8s
+	_, err = c.client.Apply(ctx, c.input)
 	if err != nil {
 		return err
 	}
 
 	// fetch the same from K8s
-	c.output, err = ri.Get(c.input.GetName(), metav1.GetOptions{})
+	c.output, err = c.client.Get(
+		ctx,
+		gvk,
+		c.input.GetNamespace(),
+		c.input.GetName(),
+	)
 	return
 }
 
@@ -97,9 +125,15 @@ func (c *TestA) postsetup() error {
 }
 
 func (c *TestA) teardown() error {
-	ri := c.getResourceInterfaceOrDie()
+	if c.input == nil {
+		// crd of this run was never rewritten
+		return nil
+	}
 	deletePropagation := metav1.DeletePropagationForeground
-	return ri.Delete(
+	return c.client.Delete(
+		context.Background(),
+		c.input.GroupVersionKind(),
+		c.input.GetNamespace(),
 		c.input.GetName(),
 		&metav1.DeleteOptions{PropagationPolicy: &deletePropagation},
 	)
@@ -0,0 +1,89 @@
+package hello
+
+import (
+	"context"
+	"testing"
+
+	k8s "github.com/AmitKumarDas/kgetset"
+)
+
+func TestTestAWithFakeClient(t *testing.T) {
+	c := NewTestA(WithClient(k8s.NewFakeDynClientOrDie()))
+	err := c.Test()
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+}
+
+func TestTestASetupFetchesCRD(t *testing.T) {
+	c := NewTestA(WithClient(k8s.NewFakeDynClientOrDie()))
+	err := c.Setup()
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if c.output == nil {
+		t.Fatalf("test failed: expected crd got nil")
+	}
+	if c.output.GetName() != c.input.GetName() {
+		t.Fatalf(
+			"test failed: expected crd %q got %q",
+			c.input.GetName(),
+			c.output.GetName(),
+		)
+	}
+}
+
+func TestTestARunsDoNotCollide(t *testing.T) {
+	client := k8s.NewFakeDynClientOrDie()
+	first := NewTestA(WithClient(client), WithRunID("run-1"))
+	second := NewTestA(WithClient(client), WithRunID("run-2"))
+	err := first.Setup()
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if first.input.GetName() == crdInst.GetName() {
+		t.Fatalf("test failed: expected crd of the run got %q", first.input.GetName())
+	}
+	if first.input.GetLabels()[k8s.RunIDLabelKey] != "run-1" {
+		t.Fatalf("test failed: expected run label got %v", first.input.GetLabels())
+	}
+
+	// second run deletes its crd while the first is running
+	err = second.Test()
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	_, err = client.Get(
+		context.Background(),
+		first.input.GroupVersionKind(),
+		"",
+		first.input.GetName(),
+	)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+}
+
+func TestTestARecordsTranscript(t *testing.T) {
+	client := k8s.NewFakeDynClientOrDie()
+	c := NewTestA(WithClient(client))
+	err := c.Test()
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	entries := client.Transcript().Entries()
+	if len(entries) == 0 {
+		t.Fatalf("test failed: expected transcript entries got none")
+	}
+	for _, e := range entries {
+		if e.Step == "" {
+			t.Fatalf("test failed: expected step for %s %s", e.Verb, e.Name)
+		}
+		if e.GVR == "" {
+			t.Fatalf("test failed: expected gvr for %s %s", e.Verb, e.Name)
+		}
+	}
+	if entries[0].Step != "setup" {
+		t.Fatalf("test failed: expected step %q got %q", "setup", entries[0].Step)
+	}
+}
@@ -29,7 +29,7 @@ var crdInst *unstructured.Unstructured = &unstructured.Unstructured{
 var _ *unstructured.Unstructured = &unstructured.Unstructured{
 	Object: map[string]interface{}{
 		"kind":       "Hello",
-		"apiVersion": "v1",
+		"apiVersion": "openebs.io/v1",
 		"metadata": map[string]interface{}{
 			"name":      "my-hello",
 			"namespace": "default",
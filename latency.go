@@ -0,0 +1,182 @@
+package kgetset
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// LatencyStats are the latencies of the api calls of a verb
+// made to a resource
+type LatencyStats struct {
+	Verb string `json:"verb"`
+
+	// GVR is the resource e.g. 'openebs.io/v1, Resource=hellos'
+	// suffixed with its subresource if any
+	GVR string `json:"gvr"`
+
+	Count  int `json:"count"`
+	Errors int `json:"errors"`
+
+	// Attempts made to K8s by these calls including retries
+	Attempts int `json:"attempts"`
+
+	P50 time.Duration `json:"p50"`
+	P95 time.Duration `json:"p95"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// key identifies the verb & resource of these stats across
+// test runs. A resource served by a run group is hence keyed
+// by its base group.
+func (s LatencyStats) key() string {
+	// gvr starts with its group
+	return s.Verb + " " + BaseGroup(s.GVR)
+}
+
+// LatencyReport are the latency stats of api calls sorted by
+// their resource & verb
+type LatencyReport []LatencyStats
+
+// LatencyReporter reports the latencies of api calls
+//
+// NOTE:
+//  DynClient is a latency reporter
+type LatencyReporter interface {
+	LatencyReport() LatencyReport
+}
+
+// LatencyReport aggregates the latencies of the api calls
+// recorded in this client's transcript during the current test
+// run per verb & resource
+//
+// NOTE:
+//  Percentiles are of the latencies of each attempt made to
+// K8s. Backoff between retries is hence not reported as api
+// latency. A call that did not complete any attempt e.g. timed
+// out is reported with its own latency. Calls that failed
+// before their kind got mapped are not reported.
+func (uc *DynClient) LatencyReport() LatencyReport {
+	if uc.transcript == nil {
+		return nil
+	}
+	samples := map[string][]time.Duration{}
+	stats := map[string]*LatencyStats{}
+	for _, e := range uc.transcript.runEntries() {
+		if e.GVR == "" {
+			continue
+		}
+		s := LatencyStats{Verb: e.Verb, GVR: e.GVR}
+		if e.Subresource != "" {
+			s.GVR = s.GVR + "/" + e.Subresource
+		}
+		key := s.key()
+		if stats[key] == nil {
+			stats[key] = &s
+		}
+		stats[key].Count++
+		if e.Error != "" {
+			stats[key].Errors++
+		}
+		attempts := e.AttemptLatencies
+		if len(attempts) == 0 {
+			attempts = []time.Duration{e.Latency}
+		}
+		stats[key].Attempts += len(attempts)
+		samples[key] = append(samples[key], attempts...)
+	}
+
+	var report LatencyReport
+	for key, s := range stats {
+		latencies := samples[key]
+		sort.Slice(latencies, func(i, j int) bool {
+			return latencies[i] < latencies[j]
+		})
+		s.P50 = percentile(latencies, 50)
+		s.P95 = percentile(latencies, 95)
+		s.P99 = percentile(latencies, 99)
+		s.Max = latencies[len(latencies)-1]
+		report = append(report, *s)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].GVR != report[j].GVR {
+			return report[i].GVR < report[j].GVR
+		}
+		return report[i].Verb < report[j].Verb
+	})
+	return report
+}
+
+// percentile returns the nearest rank percentile of the
+// provided sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// String implements Stringer interface
+func (r LatencyReport) String() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "VERB\tRESOURCE\tCOUNT\tERRORS\tATTEMPTS\tP50\tP95\tP99\tMAX\n")
+	for _, s := range r {
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\n",
+			s.Verb,
+			s.GVR,
+			s.Count,
+			s.Errors,
+			s.Attempts,
+			s.P50,
+			s.P95,
+			s.P99,
+			s.Max,
+		)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// Regressions returns the stats of this report whose p50 is
+// the provided factor times or more of the one in the provided
+// baseline e.g. a factor of 10 reports a get that went from
+// 5ms to 50ms
+//
+// NOTE:
+//  Verbs & resources missing from the baseline are skipped.
+// Resources of a run group are compared with the ones of the
+// same base group in the baseline.
+func (r LatencyReport) Regressions(baseline LatencyReport, factor float64) []string {
+	base := map[string]LatencyStats{}
+	for _, s := range baseline {
+		base[s.key()] = s
+	}
+	var regressions []string
+	for _, s := range r {
+		b, ok := base[s.key()]
+		if !ok || b.P50 <= 0 {
+			continue
+		}
+		ratio := float64(s.P50) / float64(b.P50)
+		if ratio >= factor {
+			regressions = append(
+				regressions,
+				fmt.Sprintf(
+					"%s p50 went from %s to %s (%.1fx)",
+					s.key(),
+					b.P50,
+					s.P50,
+					ratio,
+				),
+			)
+		}
+	}
+	return regressions
+}
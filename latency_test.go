@@ -0,0 +1,184 @@
+package kgetset
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestLatencyReport(t *testing.T) {
+	client := NewFakeDynClientOrDie()
+	gvr := "/v1, Resource=namespaces"
+	for i := 1; i <= 100; i++ {
+		entry := TranscriptEntry{Verb: "get", GVR: gvr, Latency: time.Duration(i) * time.Millisecond}
+		if i%10 == 0 {
+			entry.Error = "not found"
+		}
+		client.transcript.add(entry)
+	}
+	client.transcript.add(TranscriptEntry{Verb: "get", GVR: gvr, Subresource: "status", Latency: time.Second})
+	// calls whose kind was not mapped are not reported
+	client.transcript.add(TranscriptEntry{Verb: "get", Latency: time.Hour})
+
+	report := client.LatencyReport()
+	if len(report) != 2 {
+		t.Fatalf("test failed: expected 2 stats got %d: %s", len(report), report)
+	}
+	got := report[0]
+	expected := LatencyStats{
+		Verb:     "get",
+		GVR:      gvr,
+		Count:    100,
+		Errors:   10,
+		Attempts: 100,
+		P50:      50 * time.Millisecond,
+		P95:      95 * time.Millisecond,
+		P99:      99 * time.Millisecond,
+		Max:      100 * time.Millisecond,
+	}
+	if got != expected {
+		t.Fatalf("test failed: expected %+v got %+v", expected, got)
+	}
+	if report[1].GVR != gvr+"/status" || report[1].Max != time.Second {
+		t.Fatalf("test failed: expected status stats got %+v", report[1])
+	}
+
+	baseline := LatencyReport{expected}
+	baseline[0].P50 = 5 * time.Millisecond
+	regressions := report.Regressions(baseline, 10)
+	if len(regressions) != 1 || !strings.Contains(regressions[0], "(10.0x)") {
+		t.Fatalf("test failed: expected a 10x regression got %v", regressions)
+	}
+	if regressions := report.Regressions(baseline, 11); len(regressions) != 0 {
+		t.Fatalf("test failed: expected no regressions got %v", regressions)
+	}
+}
+
+func TestLatencyReportExcludesRetryBackoff(t *testing.T) {
+	client := NewFakeDynClientOrDie()
+	client.retryPolicy = RetryPolicy{
+		Backoff: wait.Backoff{Duration: 100 * time.Millisecond, Steps: 3},
+		Budget:  10,
+		Classes: []ErrorClass{ErrorClassThrottled},
+	}
+	var attempts int
+	client.dynamic.(*dynamicfake.FakeDynamicClient).PrependReactor(
+		"get",
+		"namespaces",
+		func(clienttesting.Action) (bool, runtime.Object, error) {
+			attempts++
+			if attempts == 1 {
+				return true, nil, k8serrors.NewTooManyRequests("slow down", 1)
+			}
+			return false, nil, nil
+		},
+	)
+	_, _ = client.Get(context.Background(), namespaceGVK, "", "my-ns")
+
+	report := client.LatencyReport()
+	if len(report) != 1 || report[0].Count != 1 || report[0].Attempts != 2 {
+		t.Fatalf("test failed: expected 1 get with 2 attempts got %s", report)
+	}
+	if report[0].Max >= 100*time.Millisecond {
+		t.Fatalf("test failed: expected backoff to be excluded got max %s", report[0].Max)
+	}
+	entries := client.Transcript().Entries()
+	if entries[0].Latency < 100*time.Millisecond {
+		t.Fatalf("test failed: expected call latency to include backoff got %s", entries[0].Latency)
+	}
+}
+
+func TestResultHasLatencies(t *testing.T) {
+	client := NewFakeDynClientOrDie()
+	suite := &TestAbstract{
+		Observers: []StepObserver{client},
+		Steps: []Step{
+			NewStep("list", func() error {
+				_, err := client.List(context.Background(), namespaceGVK, "", metav1.ListOptions{})
+				return err
+			}),
+		},
+	}
+	err := suite.Test()
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	result := suite.Result()
+	if len(result.Latencies) != 1 || result.Latencies[0].Verb != "list" {
+		t.Fatalf("test failed: expected list latencies got %s", result.Latencies)
+	}
+}
+
+func TestResultHasLatenciesOfItsRunOnly(t *testing.T) {
+	client := NewFakeDynClientOrDie()
+	// calls made before the tests are not reported
+	_, err := client.List(context.Background(), namespaceGVK, "", metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	newSuite := func(verb string, call func() error) *TestAbstract {
+		return &TestAbstract{
+			Observers: []StepObserver{client},
+			Steps:     []Step{NewStep(verb, call)},
+		}
+	}
+	first := newSuite("create", func() error {
+		ns := &unstructured.Unstructured{}
+		ns.SetAPIVersion("v1")
+		ns.SetKind("Namespace")
+		ns.SetName("my-ns")
+		_, err := client.Create(context.Background(), namespaceGVK, "", ns)
+		return err
+	})
+	second := newSuite("get", func() error {
+		_, err := client.Get(context.Background(), namespaceGVK, "", "my-ns")
+		return err
+	})
+	for _, suite := range []*TestAbstract{first, second} {
+		err := suite.Test()
+		if err != nil {
+			t.Fatalf("test failed: %+v", err)
+		}
+	}
+	for suite, verb := range map[*TestAbstract]string{first: "create", second: "get"} {
+		latencies := suite.Result().Latencies
+		if len(latencies) != 1 || latencies[0].Verb != verb || latencies[0].Count != 1 {
+			t.Fatalf("test failed: expected a single %s got %s", verb, latencies)
+		}
+	}
+}
+
+func TestRegressionsAcrossRuns(t *testing.T) {
+	var reports []LatencyReport
+	for _, runID := range []string{"20200101-000000-aaaaa", "20200102-000000-bbbbb"} {
+		crd, err := RunCRD(newTestCRD("openebs.io", "hellos", "Hello", nil, nil), runID)
+		if err != nil {
+			t.Fatalf("test failed: %+v", err)
+		}
+		client := NewFakeDynClientOrDie(crd)
+		gvk := schema.GroupVersionKind{Group: RunGroup(runID, "openebs.io"), Version: "v1", Kind: "Hello"}
+		_, _ = client.Get(context.Background(), gvk, "default", "my-hello")
+		reports = append(reports, client.LatencyReport())
+	}
+	baseline, report := reports[0], reports[1]
+	if len(baseline) != 1 || len(report) != 1 || baseline[0].GVR == report[0].GVR {
+		t.Fatalf("test failed: expected a run group per report got %v & %v", baseline, report)
+	}
+
+	baseline[0].P50 = 5 * time.Millisecond
+	report[0].P50 = 50 * time.Millisecond
+	regressions := report.Regressions(baseline, 10)
+	if len(regressions) != 1 || !strings.Contains(regressions[0], "get openebs.io/v1, Resource=hellos") {
+		t.Fatalf("test failed: expected a regression of hellos got %v", regressions)
+	}
+}
@@ -0,0 +1,362 @@
+package kgetset
+
+import (
+	"bytes"
+	"context"
+	stdjson "encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// manifestExts are the extensions of manifest files read from
+// a directory
+var manifestExts = map[string]bool{".yaml": true, ".yml": true, ".json": true}
+
+// ReadObjects decodes the objects of the provided multi
+// document yaml or json stream. Items of a List are returned
+// as objects of their own.
+func ReadObjects(r io.Reader) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+	decoder := yaml.NewYAMLOrJSONDecoder(r, 4096)
+	for doc := 1; ; doc++ {
+		var raw stdjson.RawMessage
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			return objs, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode document %d", doc)
+		}
+		raw = bytes.TrimSpace(raw)
+		if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+			// empty document
+			continue
+		}
+		// numbers are decoded as int64 or float64 the way
+		// K8s objects are
+		obj := &unstructured.Unstructured{}
+		err = json.Unmarshal(raw, &obj.Object)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode document %d", doc)
+		}
+		if !obj.IsList() {
+			objs = append(objs, obj)
+			continue
+		}
+		list, err := obj.ToList()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode list at document %d", doc)
+		}
+		for i := range list.Items {
+			objs = append(objs, &list.Items[i])
+		}
+	}
+}
+
+// ReadObjectsFromPath decodes the objects of the provided file
+// or of the yaml & json files of the provided directory in
+// the order of their names. Path - reads from stdin.
+func ReadObjectsFromPath(path string) ([]*unstructured.Unstructured, error) {
+	if path == "-" {
+		objs, err := ReadObjects(os.Stdin)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read objects from stdin")
+		}
+		return objs, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read objects from %q", path)
+	}
+	var files = []string{path}
+	if info.IsDir() {
+		files = nil
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read objects from %q", path)
+		}
+		for _, e := range entries {
+			if e.IsDir() || !manifestExts[strings.ToLower(filepath.Ext(e.Name()))] {
+				continue
+			}
+			files = append(files, filepath.Join(path, e.Name()))
+		}
+	}
+
+	var objs []*unstructured.Unstructured
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read objects from %q", file)
+		}
+		fileObjs, err := ReadObjects(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read objects from %q", file)
+		}
+		objs = append(objs, fileObjs...)
+	}
+	return objs, nil
+}
+
+// objectRank orders the provided object by its dependencies
+// i.e. namespaces, then CRDs & then everything else
+func objectRank(obj *unstructured.Unstructured) int {
+	switch {
+	case obj.GroupVersionKind().GroupKind() == namespaceGVK.GroupKind():
+		return 0
+	case isCRD(obj):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// SortObjects returns the provided objects sorted by their
+// dependencies. Objects of the same rank retain their order.
+func SortObjects(objs []*unstructured.Unstructured) []*unstructured.Unstructured {
+	sorted := append([]*unstructured.Unstructured(nil), objs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return objectRank(sorted[i]) < objectRank(sorted[j])
+	})
+	return sorted
+}
+
+// ObjectResult is the outcome of an operation on an object
+type ObjectResult struct {
+	// Object is the object the operation was invoked with
+	Object *unstructured.Unstructured
+
+	// Result is the object returned by K8s if any
+	Result *unstructured.Unstructured
+
+	// Created is true if the object was created
+	Created bool
+
+	Err error
+}
+
+// String implements Stringer interface
+func (r ObjectResult) String() string {
+	status := "ok"
+	if r.Err != nil {
+		status = fmt.Sprintf("failed: %v", r.Err)
+	} else if r.Created {
+		status = "created"
+	}
+	return fmt.Sprintf(
+		"%s %s: %s",
+		r.Object.GroupVersionKind(),
+		nameOf(r.Object),
+		status,
+	)
+}
+
+// ObjectResults are the outcomes of a bulk operation in the
+// order the objects were operated upon
+type ObjectResults []ObjectResult
+
+// Err returns an error listing the failed objects if any
+func (rs ObjectResults) Err() error {
+	var msgs []string
+	for _, r := range rs {
+		if r.Err != nil {
+			msgs = append(msgs, r.String())
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.Errorf(
+		"failed %d of %d objects: %s",
+		len(msgs),
+		len(rs),
+		strings.Join(msgs, ": "),
+	)
+}
+
+// BulkConfig is used to operate on many objects at once
+type BulkConfig struct {
+	// Namespace is set against namespaced objects that do not
+	// have one
+	Namespace string
+
+	// ApplyOptions are used if the objects are applied
+	ApplyOptions []func(*ApplyConfig)
+}
+
+// WithDefaultNamespace sets the namespace of namespaced objects
+// that do not have one
+func WithDefaultNamespace(namespace string) func(*BulkConfig) {
+	return func(c *BulkConfig) {
+		c.Namespace = namespace
+	}
+}
+
+// WithApplyOptions sets the options used to apply objects
+func WithApplyOptions(options ...func(*ApplyConfig)) func(*BulkConfig) {
+	return func(c *BulkConfig) {
+		c.ApplyOptions = append(c.ApplyOptions, options...)
+	}
+}
+
+// CreateObjects creates the provided objects in the order of
+// their dependencies
+//
+// NOTE:
+//  CRDs are waited upon to be established before creating
+// the objects that follow them. A failed object does not
+// stop the remaining ones.
+//
+// NOTE:
+//  Dry run CRDs are never established. Hence objects of their
+// kinds fail in dry run mode.
+func (uc *DynClient) CreateObjects(
+	ctx context.Context,
+	objs []*unstructured.Unstructured,
+	options ...func(*BulkConfig),
+) ObjectResults {
+	return uc.bulk(ctx, objs, options, func(c *BulkConfig, obj *unstructured.Unstructured) ObjectResult {
+		got, err := uc.Create(ctx, obj.GroupVersionKind(), obj.GetNamespace(), obj)
+		return ObjectResult{Object: obj, Result: got, Created: err == nil, Err: err}
+	})
+}
+
+// ApplyObjects applies the provided objects in the order of
+// their dependencies. CRDs are waited upon the way
+// CreateObjects does.
+func (uc *DynClient) ApplyObjects(
+	ctx context.Context,
+	objs []*unstructured.Unstructured,
+	options ...func(*BulkConfig),
+) ObjectResults {
+	return uc.bulk(ctx, objs, options, func(c *BulkConfig, obj *unstructured.Unstructured) ObjectResult {
+		result := ObjectResult{Object: obj}
+		applied, err := uc.Apply(ctx, obj, c.ApplyOptions...)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		result.Result = applied.Object
+		result.Created = applied.Created
+		return result
+	})
+}
+
+func (uc *DynClient) bulk(
+	ctx context.Context,
+	objs []*unstructured.Unstructured,
+	options []func(*BulkConfig),
+	fn func(c *BulkConfig, obj *unstructured.Unstructured) ObjectResult,
+) ObjectResults {
+	c := &BulkConfig{Namespace: metav1.NamespaceDefault}
+	for _, o := range options {
+		o(c)
+	}
+
+	var results ObjectResults
+	var crdResults []int
+	for _, obj := range SortObjects(objs) {
+		if objectRank(obj) > 1 && len(crdResults) != 0 {
+			uc.waitForCRDs(ctx, results, crdResults)
+			crdResults = nil
+		}
+		var result ObjectResult
+		obj, err := uc.withDefaultNamespace(obj, c.Namespace)
+		if err != nil {
+			result = ObjectResult{Object: obj, Err: err}
+		} else {
+			result = fn(c, obj)
+		}
+		fmt.Printf("%s\n", result)
+		results = append(results, result)
+		if isCRD(obj) && result.Err == nil && !uc.IsDryRun(ctx) {
+			crdResults = append(crdResults, len(results)-1)
+		}
+	}
+	if len(crdResults) != 0 {
+		uc.waitForCRDs(ctx, results, crdResults)
+	}
+	return results
+}
+
+// waitForCRDs waits for the CRDs at the provided indexes of the
+// provided results to be established. Errors are set against
+// the results.
+func (uc *DynClient) waitForCRDs(ctx context.Context, results ObjectResults, indexes []int) {
+	for _, i := range indexes {
+		name := results[i].Object.GetName()
+		err := WaitFor(ctx, uc.CRDEstablished(name))
+		if err != nil {
+			results[i].Err = errors.Wrapf(err, "crd %q is not established", name)
+		}
+	}
+}
+
+// withDefaultNamespace returns a copy of the provided object
+// with the provided namespace if it is namespaced & does not
+// have one
+func (uc *DynClient) withDefaultNamespace(
+	obj *unstructured.Unstructured,
+	namespace string,
+) (*unstructured.Unstructured, error) {
+	if obj.GetNamespace() != "" || namespace == "" {
+		return obj, nil
+	}
+	mapping, err := uc.RESTMapping(obj.GroupVersionKind())
+	if err != nil {
+		return obj, err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return obj, nil
+	}
+	defaulted, err := toJSONUnstructured(obj)
+	if err != nil {
+		return obj, err
+	}
+	defaulted.SetNamespace(namespace)
+	return defaulted, nil
+}
+
+// DeleteObjects deletes the provided objects in the reverse
+// order of their dependencies. Objects that are not found are
+// not considered as errors.
+func (uc *DynClient) DeleteObjects(
+	ctx context.Context,
+	objs []*unstructured.Unstructured,
+	options ...func(*BulkConfig),
+) ObjectResults {
+	c := &BulkConfig{Namespace: metav1.NamespaceDefault}
+	for _, o := range options {
+		o(c)
+	}
+
+	sorted := SortObjects(objs)
+	var results ObjectResults
+	for i := len(sorted) - 1; i >= 0; i-- {
+		obj, err := uc.withDefaultNamespace(sorted[i], c.Namespace)
+		if err == nil {
+			err = uc.Delete(ctx, obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName(), nil)
+		}
+		if k8serrors.IsNotFound(errors.Cause(err)) {
+			err = nil
+		}
+		result := ObjectResult{Object: obj, Err: err}
+		fmt.Printf("%s\n", result)
+		results = append(results, result)
+	}
+	return results
+}
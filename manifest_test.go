@@ -0,0 +1,113 @@
+package kgetset
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testManifest = `
+apiVersion: openebs.io/v1
+kind: Hello
+metadata:
+  name: my-hello
+spec:
+  replicas: 3
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: hellos.openebs.io
+spec:
+  group: openebs.io
+  version: v1
+  scope: Namespaced
+  names:
+    plural: hellos
+    kind: Hello
+---
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: openebs.io/v1
+  kind: Hello
+  metadata:
+    name: your-hello
+    namespace: kgetset
+- apiVersion: v1
+  kind: Namespace
+  metadata:
+    name: kgetset
+`
+
+func TestReadAndCreateObjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kgetset")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "a.yaml"), []byte(testManifest), 0600)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	// files other than yaml & json are ignored
+	err = ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("# hello"), 0600)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+
+	objs, err := ReadObjectsFromPath(dir)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if len(objs) != 4 {
+		t.Fatalf("test failed: expected 4 objects got %d", len(objs))
+	}
+
+	var order []string
+	for _, obj := range SortObjects(objs) {
+		order = append(order, obj.GetName())
+	}
+	expected := "kgetset hellos.openebs.io my-hello your-hello"
+	if strings.Join(order, " ") != expected {
+		t.Fatalf("test failed: expected order %q got %q", expected, strings.Join(order, " "))
+	}
+
+	ctx := context.Background()
+	client := NewFakeDynClientOrDie()
+	results := client.CreateObjects(ctx, objs)
+	if results.Err() != nil {
+		t.Fatalf("test failed: %+v", results.Err())
+	}
+	hello := results[2].Result
+	if hello.GetNamespace() != "default" {
+		t.Fatalf("test failed: expected namespace default got %q", hello.GetNamespace())
+	}
+	replicas, ok := hello.Object["spec"].(map[string]interface{})["replicas"].(int64)
+	if !ok || replicas != 3 {
+		t.Fatalf("test failed: expected int64 replicas 3 got %v", hello.Object["spec"])
+	}
+
+	// applying again is idempotent
+	results = client.ApplyObjects(ctx, objs)
+	if results.Err() != nil {
+		t.Fatalf("test failed: %+v", results.Err())
+	}
+	for _, r := range results {
+		if r.Created {
+			t.Fatalf("test failed: expected no creation got %s", r)
+		}
+	}
+
+	results = client.DeleteObjects(ctx, objs)
+	if results.Err() != nil {
+		t.Fatalf("test failed: %+v", results.Err())
+	}
+	if results[0].Object.GetName() != "your-hello" || results[3].Object.GetName() != "kgetset" {
+		t.Fatalf("test failed: expected reverse order got %v", results)
+	}
+}
@@ -0,0 +1,258 @@
+package kgetset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/rand"
+)
+
+// RunIDLabelKey is the label set against the namespaces &
+// CRDs created for a test run. Its value is the run id.
+const RunIDLabelKey = "kgetset.openebs.io/run-id"
+
+// DefaultSweepAge is the age after which a run namespace or a
+// run CRD is considered to be left over from a crashed run
+const DefaultSweepAge = 1 * time.Hour
+
+// runGroupPrefix starts every api group served by a run CRD
+const runGroupPrefix = "run-"
+
+var namespaceGVK = schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}
+
+// NewRunID returns a unique id of a test run
+func NewRunID() string {
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102-150405"), rand.String(5))
+}
+
+// RunGroup returns the api group served by the CRDs of the
+// provided run. CRDs are cluster scoped & hence need a group
+// of their own to avoid collisions with concurrent runs.
+func RunGroup(runID, group string) string {
+	// group must be a valid dns subdomain
+	return runGroupPrefix + strings.ToLower(runID) + "." + group
+}
+
+// BaseGroup returns the group that the provided run group was
+// derived from. Any other group is returned as is.
+//
+// NOTE:
+//  This lets results of different runs be compared
+func BaseGroup(group string) string {
+	dot := strings.Index(group, ".")
+	if !strings.HasPrefix(group, runGroupPrefix) || dot < 0 {
+		return group
+	}
+	return group[dot+1:]
+}
+
+// RunCRD returns a copy of the provided CRD fixture that serves
+// the group of the provided run. The copy is labelled with the
+// run id so that it gets swept if the run crashes.
+func RunCRD(crd *unstructured.Unstructured, runID string) (*unstructured.Unstructured, error) {
+	// json copy since fixtures may hold go types that can
+	// not be deep copied
+	rewritten, err := toJSONUnstructured(crd)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to rewrite crd %q for run %q", crd.GetName(), runID)
+	}
+	group, _, _ := unstructured.NestedString(rewritten.Object, "spec", "group")
+	plural, _, _ := unstructured.NestedString(rewritten.Object, "spec", "names", "plural")
+	if group == "" || plural == "" {
+		return nil, errors.Errorf(
+			"failed to rewrite crd %q for run %q: missing spec.group or spec.names.plural",
+			crd.GetName(),
+			runID,
+		)
+	}
+	group = RunGroup(runID, group)
+	err = unstructured.SetNestedField(rewritten.Object, group, "spec", "group")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to rewrite crd %q for run %q", crd.GetName(), runID)
+	}
+	rewritten.SetName(plural + "." + group)
+
+	labels := rewritten.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[RunIDLabelKey] = runID
+	rewritten.SetLabels(labels)
+	return rewritten, nil
+}
+
+// RunNamespace is a namespace created for a single test run.
+// Namespaced fixtures are rewritten into this namespace so
+// that concurrent runs do not collide.
+type RunNamespace struct {
+	// Name of the namespace
+	Name string
+
+	// RunID is the id of the run this namespace belongs to
+	RunID string
+
+	client *DynClient
+}
+
+// NewRunNamespace returns a run namespace whose name starts
+// with the provided prefix. Namespace is not created till
+// Create is invoked.
+func NewRunNamespace(client *DynClient, runID string, prefix string) *RunNamespace {
+	if runID == "" {
+		runID = NewRunID()
+	}
+	name := fmt.Sprintf("%s-%s", prefix, rand.String(5))
+	return &RunNamespace{
+		// namespace name must be a valid dns label
+		Name:   strings.ToLower(name),
+		RunID:  runID,
+		client: client,
+	}
+}
+
+// Create creates this namespace labelled with its run id
+func (n *RunNamespace) Create(ctx context.Context) error {
+	ns := &unstructured.Unstructured{}
+	ns.SetAPIVersion(namespaceGVK.GroupVersion().String())
+	ns.SetKind(namespaceGVK.Kind)
+	ns.SetName(n.Name)
+	ns.SetLabels(map[string]string{RunIDLabelKey: n.RunID})
+
+	_, err := n.client.Create(ctx, namespaceGVK, "", ns)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create run namespace %q", n.Name)
+	}
+	fmt.Printf("created namespace %q for run %q\n", n.Name, n.RunID)
+	return nil
+}
+
+// Delete deletes this namespace along with its objects
+//
+// NOTE:
+//  A namespace that is already deleted is not an error
+func (n *RunNamespace) Delete(ctx context.Context) error {
+	deletePropagation := metav1.DeletePropagationForeground
+	err := n.client.Delete(
+		ctx,
+		namespaceGVK,
+		"",
+		n.Name,
+		&metav1.DeleteOptions{PropagationPolicy: &deletePropagation},
+	)
+	if err != nil && !k8serrors.IsNotFound(errors.Cause(err)) {
+		return errors.Wrapf(err, "failed to delete run namespace %q", n.Name)
+	}
+	return nil
+}
+
+// Rewrite returns a copy of the provided fixture that belongs
+// to this namespace
+//
+// NOTE:
+//  Only fixtures that have a namespace are rewritten. Cluster
+// scoped fixtures are returned as copies.
+func (n *RunNamespace) Rewrite(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	// json copy since fixtures may hold go types that can
+	// not be deep copied
+	rewritten, err := toJSONUnstructured(obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to rewrite %q into %q", obj.GetName(), n.Name)
+	}
+	if rewritten.GetNamespace() != "" {
+		rewritten.SetNamespace(n.Name)
+	}
+	return rewritten, nil
+}
+
+// SweepRunNamespaces deletes the run namespaces that are older
+// than the provided age. These are left over from runs that
+// crashed before their teardown. Names of deleted namespaces
+// are returned.
+//
+// NOTE:
+//  Namespaces of the provided run ids are never deleted
+func (uc *DynClient) SweepRunNamespaces(
+	ctx context.Context,
+	age time.Duration,
+	skipRunIDs ...string,
+) ([]string, error) {
+	return uc.sweep(ctx, namespaceGVK, "namespace", age, skipRunIDs)
+}
+
+// SweepRunCRDs deletes the run CRDs that are older than the
+// provided age. These are left over from runs that crashed
+// before their teardown. Names of deleted CRDs are returned.
+//
+// NOTE:
+//  CRDs of the provided run ids are never deleted
+func (uc *DynClient) SweepRunCRDs(
+	ctx context.Context,
+	age time.Duration,
+	skipRunIDs ...string,
+) ([]string, error) {
+	return uc.sweep(ctx, crdGVK, "crd", age, skipRunIDs)
+}
+
+// sweep deletes the cluster scoped objects of the provided kind
+// that are labelled with a run id & are older than the provided
+// age
+func (uc *DynClient) sweep(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	what string,
+	age time.Duration,
+	skipRunIDs []string,
+) ([]string, error) {
+	list, err := uc.List(
+		ctx,
+		gvk,
+		"",
+		metav1.ListOptions{LabelSelector: RunIDLabelKey},
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to sweep run %ss", what)
+	}
+
+	skip := map[string]bool{}
+	for _, id := range skipRunIDs {
+		skip[id] = true
+	}
+	deletePropagation := metav1.DeletePropagationForeground
+	var swept []string
+	for _, obj := range list.Items {
+		runID, ok := obj.GetLabels()[RunIDLabelKey]
+		if !ok || skip[runID] || obj.GetDeletionTimestamp() != nil {
+			continue
+		}
+		created := obj.GetCreationTimestamp()
+		if !created.IsZero() && time.Since(created.Time) < age {
+			continue
+		}
+		err := uc.Delete(
+			ctx,
+			gvk,
+			"",
+			obj.GetName(),
+			&metav1.DeleteOptions{PropagationPolicy: &deletePropagation},
+		)
+		if err != nil && !k8serrors.IsNotFound(errors.Cause(err)) {
+			return swept, errors.Wrapf(
+				err,
+				"failed to sweep run %s %q of run %q",
+				what,
+				obj.GetName(),
+				runID,
+			)
+		}
+		fmt.Printf("swept %s %q of run %q\n", what, obj.GetName(), runID)
+		swept = append(swept, obj.GetName())
+	}
+	return swept, nil
+}
@@ -0,0 +1,135 @@
+package kgetset
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSweepRunNamespaces(t *testing.T) {
+	ctx := context.Background()
+	client := NewFakeDynClientOrDie()
+	old := NewRunNamespace(client, "crashed", "kgetset")
+	current := NewRunNamespace(client, "current", "kgetset")
+	for _, ns := range []*RunNamespace{old, current} {
+		err := ns.Create(ctx)
+		if err != nil {
+			t.Fatalf("test failed: %+v", err)
+		}
+	}
+
+	// fake client does not set creation timestamps hence all
+	// run namespaces are old enough
+	swept, err := client.SweepRunNamespaces(ctx, DefaultSweepAge, "current")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if len(swept) != 1 || swept[0] != old.Name {
+		t.Fatalf("test failed: expected [%s] got %v", old.Name, swept)
+	}
+	_, err = client.Get(ctx, namespaceGVK, "", current.Name)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	err = current.Delete(ctx)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	// deleting again is not an error
+	err = current.Delete(ctx)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+}
+
+func TestRunNamespaceRewrite(t *testing.T) {
+	ns := NewRunNamespace(nil, "", "kgetset")
+	fixture := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind":       "Onlyone",
+			"apiVersion": "openebs.io/v1alpha1",
+			"metadata": map[string]interface{}{
+				"name":      "onlyone-a",
+				"namespace": "default",
+				"labels":    map[string]string{"app": "testing"},
+			},
+			"spec": map[string]interface{}{"count": 1},
+		},
+	}
+	got, err := ns.Rewrite(fixture)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if got.GetNamespace() != ns.Name {
+		t.Fatalf("test failed: expected namespace %q got %q", ns.Name, got.GetNamespace())
+	}
+	if fixture.GetNamespace() != "default" {
+		t.Fatalf("test failed: fixture got modified: %q", fixture.GetNamespace())
+	}
+}
+
+func TestSweepRunCRDs(t *testing.T) {
+	ctx := context.Background()
+	client := NewFakeDynClientOrDie()
+	var crds []*unstructured.Unstructured
+	for _, runID := range []string{"crashed", "current"} {
+		crd, err := RunCRD(newTestCRD("openebs.io", "hellos", "Hello", nil, nil), runID)
+		if err != nil {
+			t.Fatalf("test failed: %+v", err)
+		}
+		_, err = client.Create(ctx, crdGVK, "", crd)
+		if err != nil {
+			t.Fatalf("test failed: %+v", err)
+		}
+		crds = append(crds, crd)
+	}
+	// crds that do not belong to a run are never swept
+	_, err := client.Create(ctx, crdGVK, "", newTestCRD("openebs.io", "byes", "Bye", nil, nil))
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+
+	swept, err := client.SweepRunCRDs(ctx, DefaultSweepAge, "current")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if len(swept) != 1 || swept[0] != crds[0].GetName() {
+		t.Fatalf("test failed: expected [%s] got %v", crds[0].GetName(), swept)
+	}
+	for _, name := range []string{crds[1].GetName(), "byes.openebs.io"} {
+		_, err = client.Get(ctx, crdGVK, "", name)
+		if err != nil {
+			t.Fatalf("test failed: %+v", err)
+		}
+	}
+}
+
+func TestRunCRD(t *testing.T) {
+	fixture := newTestCRD("openebs.io", "hellos", "Hello", nil, nil)
+	fixture.SetLabels(map[string]string{"app": "testing"})
+	got, err := RunCRD(fixture, "20060102-150405-AbCdE")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	group, _, _ := unstructured.NestedString(got.Object, "spec", "group")
+	if group != "run-20060102-150405-abcde.openebs.io" {
+		t.Fatalf("test failed: expected run group got %q", group)
+	}
+	if got.GetName() != "hellos."+group {
+		t.Fatalf("test failed: expected name %q got %q", "hellos."+group, got.GetName())
+	}
+	labels := got.GetLabels()
+	if labels[RunIDLabelKey] != "20060102-150405-AbCdE" || labels["app"] != "testing" {
+		t.Fatalf("test failed: expected run & fixture labels got %v", labels)
+	}
+	if fixture.GetName() != "hellos.openebs.io" || len(fixture.GetLabels()) != 1 {
+		t.Fatalf("test failed: fixture got modified: %v", fixture)
+	}
+	if BaseGroup(group) != "openebs.io" {
+		t.Fatalf("test failed: expected base group %q got %q", "openebs.io", BaseGroup(group))
+	}
+	if BaseGroup("openebs.io") != "openebs.io" {
+		t.Fatalf("test failed: expected group as is got %q", BaseGroup("openebs.io"))
+	}
+}
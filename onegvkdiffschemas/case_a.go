@@ -1,9 +1,11 @@
 package onegvkdiffschemas
 
 import (
+	"context"
 	"reflect"
 
 	kgs "github.com/AmitKumarDas/kgetset"
+	"github.com/AmitKumarDas/kgetset/unstruct"
 	"github.com/pkg/errors"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -11,18 +13,32 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
-	"k8s.io/client-go/dynamic"
 )
 
 type TestA struct {
 	client *kgs.DynClient
 
-	crdGVK          schema.GroupVersionKind
-	crdDynInterface dynamic.ResourceInterface
+	// runID identifies the run this test is part of
+	runID string
 
-	resGVK          schema.GroupVersionKind
-	resNamespace    string
-	resDynInterface dynamic.ResourceInterface
+	// ns is the namespace created for this run
+	ns *kgs.RunNamespace
+
+	// forceFinalize removes the finalizers of fixtures whose
+	// deletion gets stuck during teardown
+	forceFinalize bool
+
+	crdGVK schema.GroupVersionKind
+
+	// crdName is the name of the CRD of this run
+	crdName string
+
+	resGVK       schema.GroupVersionKind
+	resNamespace string
+
+	// resGVR is the resource served by the CRD of this run. This
+	// is known without discovery.
+	resGVR schema.GroupVersionResource
 
 	crd       *unstructured.Unstructured
 	resourceA *unstructured.Unstructured
@@ -34,106 +50,124 @@ type TestA struct {
 // compile time check if TestA implements Testsuite
 var _ kgs.Testsuite = &TestA{}
 
+// WithClient sets the client used by the test e.g. a
+// fake client for unit testing
+func WithClient(client *kgs.DynClient) func(*TestA) {
+	return func(c *TestA) {
+		c.client = client
+	}
+}
+
+// WithRunID sets the id of the run this test is part of
+func WithRunID(runID string) func(*TestA) {
+	return func(c *TestA) {
+		c.runID = runID
+	}
+}
+
+// WithForceFinalize removes the finalizers of fixtures whose
+// deletion gets stuck during teardown
+func WithForceFinalize() func(*TestA) {
+	return func(c *TestA) {
+		c.forceFinalize = true
+	}
+}
+
 func NewTestA(options ...func(*TestA)) *TestA {
 	c := &TestA{
 		crd:    crdInst,
 		crdGVK: crdInst.GetObjectKind().GroupVersionKind(),
 
-		resGVK:       resourceInstA.GetObjectKind().GroupVersionKind(),
-		resNamespace: resourceInstA.GetNamespace(),
-		resourceA:    resourceInstA,
-		resourceB:    resourceInstB,
-
-		client: kgs.NewDynClientOrDie(),
+		resGVK:    resourceInstA.GetObjectKind().GroupVersionKind(),
+		resourceA: resourceInstA,
+		resourceB: resourceInstB,
 	}
-
-	c.Setupfn = c.createCRD
-	c.PostSetupfn = func() error {
-		fns := kgs.TestFns{
-			c.registerScheme,
-			c.refresh,
-		}
-		return fns.Run()
+	// v1beta1 CRDs are not served by K8s 1.22 onwards
+	c.Requires = kgs.Requirements{
+		APIGroupVersions: []string{c.crdGVK.GroupVersion().String()},
 	}
 
-	c.Whenfn = func() error {
-		fns := kgs.TestFns{
-			c.createA,
-			c.createB,
-		}
-		return fns.Run()
+	c.Steps = []kgs.Step{
+		{Name: "createNamespace", Fn: c.createNamespace},
+		{Name: "createCRD", Fn: c.createCRD},
+		{Name: "waitForCRD", Fn: c.waitForCRD},
+		{Name: "registerScheme", Fn: c.registerScheme},
+		{Name: "createA", Fn: c.createA},
+		{Name: "createB", Fn: c.createB},
+		{Name: "getAndMatchA", Fn: c.getAndMatchA},
+		{Name: "getAndMatchB", Fn: c.getAndMatchB},
+		c.expectTypeDrift("getAndDecodeA", c.getAndDecodeA),
+		c.expectTypeDrift("getAndDecodeB", c.getAndDecodeB),
+		{Name: "deleteCRD", Fn: c.deleteCRD},
+		{Name: "verifyNoResInstances", Fn: c.verifyNoResInstances},
+		{Name: "waitForCRDDeletion", Fn: c.deleteCRDAndWait},
+		{Name: "deleteNamespace", Fn: c.deleteNamespace},
 	}
 
-	c.Thenfn = func() error {
+	// fixtures are cleaned up if any of the steps fail
+	c.Teardownfn = func() error {
+		ctx := context.Background()
 		fns := kgs.TestFns{
-			c.getAndMatchA,
-			c.getAndMatchB,
+			func() error { return c.deleteCRDAndWait(ctx) },
+			func() error { return c.deleteNamespace(ctx) },
 		}
-		return fns.Run()
+		// namespace is deleted even if crd deletion is stuck
+		return fns.RunAll()
 	}
 
-	c.Teardownfn = c.deleteCRD
-	c.PostTeardownfn = c.verifyNoResInstances
-
 	for _, o := range options {
 		o(c)
 	}
 
-	return c
-}
-
-func (c *TestA) getDynamicInterfaceForCRD() (dynamic.ResourceInterface, error) {
-	if c.crdDynInterface != nil {
-		return c.crdDynInterface, nil
-	}
-	cdi, err := c.client.GetResourceInterface(c.crdGVK)
-	if err != nil {
-		return nil, err
+	if c.client == nil {
+		c.client = kgs.NewDynClientOrDie()
 	}
-	c.crdDynInterface = cdi
-	return cdi, nil
-}
+	c.Observers = append(c.Observers, c.client)
 
-func (c *TestA) getDynamicInterfaceForRes() (dynamic.ResourceInterface, error) {
-	if c.resDynInterface != nil {
-		return c.resDynInterface, nil
-	}
-	cdi, err := c.client.GetResourceInterface(c.resGVK, c.resNamespace)
-	if err != nil {
-		return nil, err
-	}
-	c.resDynInterface = cdi
-	return cdi, nil
-}
+	// fixtures are rewritten into a namespace of their own
+	// to avoid collisions with concurrent runs
+	c.ns = kgs.NewRunNamespace(c.client, c.runID, "onegvkdiffschemas")
+	c.resNamespace = c.ns.Name
+
+	// crd is cluster scoped & hence serves a group of its own
+	// per run
+	c.resGVK.Group = kgs.RunGroup(c.ns.RunID, c.resGVK.Group)
+	plural, _, _ := unstructured.NestedString(c.crd.Object, "spec", "names", "plural")
+	c.crdName = plural + "." + c.resGVK.Group
+	c.resGVR = c.resGVK.GroupVersion().WithResource(plural)
 
-func (c *TestA) refreshClient() (err error) {
-	c.client, err = kgs.NewDynClient()
-	return
+	return c
 }
 
-func (c *TestA) refreshResDynInterface() (err error) {
-	c.resDynInterface, err = c.client.GetResourceInterface(c.resGVK, c.resNamespace)
-	return
+func (c *TestA) createNamespace(ctx context.Context) error {
+	return c.ns.Create(ctx)
 }
 
-func (c *TestA) refresh() error {
-	fns := kgs.TestFns{
-		c.refreshClient,
-		c.refreshResDynInterface,
-	}
-	return fns.Run()
+func (c *TestA) deleteNamespace(ctx context.Context) error {
+	return c.ns.Delete(ctx)
 }
 
-func (c *TestA) createCRD() error {
-	ri, err := c.getDynamicInterfaceForCRD()
+func (c *TestA) createCRD(ctx context.Context) error {
+	crd, err := kgs.RunCRD(c.crd, c.ns.RunID)
 	if err != nil {
 		return err
 	}
-	_, err = ri.Create(c.crd, metav1.CreateOptions{})
+	_, err = c.client.Create(ctx, c.crdGVK, "", crd)
 	return err
 }
 
-func (c *TestA) registerScheme() error {
+func (c *TestA) waitForCRD(ctx context.Context) error {
+	err := kgs.WaitFor(
+		ctx,
+		c.client.CRDEstablished(c.crdName),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "crd %q is not established", c.crdName)
+	}
+	return nil
+}
+
+func (c *TestA) registerScheme(context.Context) error {
 	addKnownTypes := func(scheme *runtime.Scheme) error {
 		scheme.AddKnownTypeWithName(c.resGVK, &unstructured.Unstructured{})
 		metav1.AddToGroupVersion(scheme, c.resGVK.GroupVersion())
@@ -148,67 +182,187 @@ func (c *TestA) registerScheme() error {
 	return schemeBuilder.AddToScheme(schemeInst)
 }
 
-func (c *TestA) createA() error {
-	ri, err := c.getDynamicInterfaceForRes()
+// rewrite returns a copy of the provided fixture that belongs
+// to the namespace & the group of this run
+func (c *TestA) rewrite(given *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	obj, err := c.ns.Rewrite(given)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	_, err = ri.Create(c.resourceA, metav1.CreateOptions{})
-	return err
+	obj.SetAPIVersion(c.resGVK.GroupVersion().String())
+	return obj, nil
 }
 
-func (c *TestA) createB() error {
-	ri, err := c.getDynamicInterfaceForRes()
+func (c *TestA) createRes(ctx context.Context, given *unstructured.Unstructured) error {
+	obj, err := c.rewrite(given)
 	if err != nil {
 		return err
 	}
-	_, err = ri.Create(c.resourceB, metav1.CreateOptions{})
+	_, err = c.client.Create(ctx, c.resGVK, c.resNamespace, obj)
 	return err
 }
 
-func (c *TestA) getAndMatchRes(given *unstructured.Unstructured) error {
-	ri, err := c.getDynamicInterfaceForRes()
+func (c *TestA) createA(ctx context.Context) error {
+	return c.createRes(ctx, c.resourceA)
+}
+
+func (c *TestA) createB(ctx context.Context) error {
+	return c.createRes(ctx, c.resourceB)
+}
+
+// getAndMatchRes verifies if the stored resource is the one
+// that was created
+//
+// NOTE:
+//  Metadata set by K8s for every object e.g. uid is not
+// matched
+func (c *TestA) getAndMatchRes(ctx context.Context, given *unstructured.Unstructured) error {
+	// given is compared as it was sent
+	expected, err := c.rewrite(given)
 	if err != nil {
 		return err
 	}
-	got, err := ri.Get(given.GetName(), metav1.GetOptions{})
+	got, err := c.client.Get(
+		ctx,
+		c.resGVK,
+		c.resNamespace,
+		given.GetName(),
+	)
 	if err != nil {
 		return err
 	}
-	if reflect.DeepEqual(given, got) {
+	got = kgs.WithoutServerMetadata(got)
+	if reflect.DeepEqual(expected, got) {
 		return nil
 	}
-	return errors.Errorf("failed match:\nexpected: %+v\ngot: %+v", given, got)
+	return errors.Errorf("failed match:\nexpected: %+v\ngot: %+v", expected, got)
 }
 
-func (c *TestA) getAndMatchA() error {
-	return c.getAndMatchRes(c.resourceA)
+func (c *TestA) getAndMatchA(ctx context.Context) error {
+	return c.getAndMatchRes(ctx, c.resourceA)
 }
 
-func (c *TestA) getAndMatchB() error {
-	return c.getAndMatchRes(c.resourceB)
+func (c *TestA) getAndMatchB(ctx context.Context) error {
+	return c.getAndMatchRes(ctx, c.resourceB)
 }
 
-func (c *TestA) deleteCRD() error {
-	ri, err := c.getDynamicInterfaceForCRD()
+// getAndDecodeRes verifies if the stored resource decodes into
+// Onlyone without dropping or mistyping any of its fields
+func (c *TestA) getAndDecodeRes(ctx context.Context, given *unstructured.Unstructured) error {
+	got, err := c.client.Get(
+		ctx,
+		c.resGVK,
+		c.resNamespace,
+		given.GetName(),
+	)
 	if err != nil {
 		return err
 	}
+	var typed Onlyone
+	return unstruct.ToTyped(got, &typed)
+}
+
+// typeDrift is the only issue expected when the stored
+// resources are decoded into Onlyone. Fixtures send spec.id as
+// a number while Onlyone declares it as a string.
+var typeDrift = unstruct.FieldIssue{Type: unstruct.IssueMistyped, Path: "spec.id"}
+
+// expectTypeDrift returns a step that passes only if the
+// provided decode reports the type drift of the fixtures &
+// nothing else
+func (c *TestA) expectTypeDrift(name string, decode func(context.Context) error) kgs.Step {
+	return kgs.Step{
+		Name: name,
+		Fn: func(ctx context.Context) error {
+			err := decode(ctx)
+			if err == nil {
+				return errors.Errorf("expected %s %s got none", typeDrift.Type, typeDrift.Path)
+			}
+			convErr, ok := errors.Cause(err).(*unstruct.ConversionError)
+			if !ok {
+				return err
+			}
+			if len(convErr.Issues) != 1 ||
+				convErr.Issues[0].Type != typeDrift.Type ||
+				convErr.Issues[0].Path != typeDrift.Path {
+				return errors.Wrapf(
+					err,
+					"expected only %s %s",
+					typeDrift.Type,
+					typeDrift.Path,
+				)
+			}
+			return nil
+		},
+	}
+}
+
+func (c *TestA) getAndDecodeA(ctx context.Context) error {
+	return c.getAndDecodeRes(ctx, c.resourceA)
+}
+
+func (c *TestA) getAndDecodeB(ctx context.Context) error {
+	return c.getAndDecodeRes(ctx, c.resourceB)
+}
+
+func (c *TestA) deleteCRD(ctx context.Context) error {
 	deletePropagation := metav1.DeletePropagationForeground
-	return ri.Delete(
-		c.crd.GetName(),
+	return c.client.Delete(
+		ctx,
+		c.crdGVK,
+		"",
+		c.crdName,
 		&metav1.DeleteOptions{PropagationPolicy: &deletePropagation},
 	)
 }
 
-func (c *TestA) verifyNoResInstances() error {
-	ri, err := c.getDynamicInterfaceForRes()
-	if err != nil {
-		return err
+func (c *TestA) deleteCRDAndWait(ctx context.Context) error {
+	deletePropagation := metav1.DeletePropagationForeground
+	options := []func(*kgs.DeletionConfig){
+		kgs.WithDeleteOptions(
+			&metav1.DeleteOptions{PropagationPolicy: &deletePropagation},
+		),
 	}
-	_, err = ri.List(metav1.ListOptions{})
-	if k8serrors.IsNotFound(err) {
-		return nil
+	if c.forceFinalize {
+		options = append(options, kgs.WithForceFinalize())
 	}
-	return err
+	return c.client.DeleteAndWait(
+		ctx,
+		c.crdGVK,
+		"",
+		c.crdName,
+		options...,
+	)
+}
+
+// verifyNoResInstances waits till the custom resources are
+// gone while their CRD is being deleted
+//
+// NOTE:
+//  Resources are listed by their known resource & not by their
+// kind since the kind is not discovered once its CRD is gone.
+// A resource that is not found implies its CRD is gone. K8s
+// removes a CRD only after its custom resources.
+func (c *TestA) verifyNoResInstances(ctx context.Context) error {
+	var remaining int
+	err := kgs.WaitFor(ctx, func(ctx context.Context) (bool, error) {
+		list, err := c.client.ListResource(
+			ctx,
+			c.resGVR,
+			c.resNamespace,
+			metav1.ListOptions{},
+		)
+		if k8serrors.IsNotFound(errors.Cause(err)) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		remaining = len(list.Items)
+		return remaining == 0, nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "%d %s remain after deleting crd %q", remaining, c.resGVR.Resource, c.crdName)
+	}
+	return nil
 }
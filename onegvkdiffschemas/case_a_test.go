@@ -0,0 +1,165 @@
+package onegvkdiffschemas
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	kgs "github.com/AmitKumarDas/kgetset"
+	"github.com/AmitKumarDas/kgetset/unstruct"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestTestAWithFakeClient(t *testing.T) {
+	c := NewTestA(WithClient(kgs.NewFakeDynClientOrDie()))
+	err := c.Test()
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+}
+
+func TestTestAWithExistingCRD(t *testing.T) {
+	c := NewTestA(WithClient(kgs.NewFakeDynClientOrDie()))
+	err := c.createCRD(context.Background())
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	err = c.Test()
+	if err == nil {
+		t.Fatalf("test failed: expected error got nil")
+	}
+}
+
+// run invokes the provided steps in order & fails the test
+// on the first error
+func run(t *testing.T, steps ...func(context.Context) error) {
+	for _, step := range steps {
+		err := step(context.Background())
+		if err != nil {
+			t.Fatalf("test failed: %+v", err)
+		}
+	}
+}
+
+func TestTestARunsDoNotCollide(t *testing.T) {
+	client := kgs.NewFakeDynClientOrDie()
+	first := NewTestA(WithClient(client), WithRunID("run-1"))
+	second := NewTestA(WithClient(client), WithRunID("run-2"))
+	if first.crdName == second.crdName {
+		t.Fatalf("test failed: expected distinct crds got %q", first.crdName)
+	}
+
+	run(t, first.createNamespace, first.createCRD, first.createA)
+	// second run deletes its crd while the first is running
+	err := second.Test()
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	err = first.getAndMatchA(context.Background())
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+}
+
+func TestFixturesHaveTypeDrift(t *testing.T) {
+	for _, fixture := range []*unstructured.Unstructured{resourceInstA, resourceInstB} {
+		var typed Onlyone
+		err := unstruct.ToTyped(fixture, &typed)
+		convErr, ok := err.(*unstruct.ConversionError)
+		if !ok {
+			t.Fatalf("test failed: %s: expected conversion error got %v", fixture.GetName(), err)
+		}
+		if len(convErr.Issues) != 1 ||
+			convErr.Issues[0].Type != unstruct.IssueMistyped ||
+			convErr.Issues[0].Path != "spec.id" {
+			t.Fatalf("test failed: %s: expected mistyped spec.id got %s", fixture.GetName(), convErr)
+		}
+	}
+}
+
+func TestTestAFailsWithoutTypeDrift(t *testing.T) {
+	c := NewTestA(WithClient(kgs.NewFakeDynClientOrDie()))
+	c.resourceB = &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind":       "Onlyone",
+			"apiVersion": "openebs.io/v1alpha1",
+			"metadata": map[string]interface{}{
+				"name":      "onlyone-b",
+				"namespace": "default",
+			},
+			"spec": map[string]interface{}{
+				"id": "123",
+			},
+		},
+	}
+	err := c.Test()
+	if err == nil {
+		t.Fatalf("test failed: expected error got nil")
+	}
+	if !strings.Contains(err.Error(), "getAndDecodeB failed: expected mistyped spec.id got none") {
+		t.Fatalf("test failed: expected missing type drift got %v", err)
+	}
+}
+
+func TestTestAFailsWithOtherDrift(t *testing.T) {
+	c := NewTestA(WithClient(kgs.NewFakeDynClientOrDie()))
+	// an unknown field is dropped along with the expected drift
+	c.resourceB = &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind":       "Onlyone",
+			"apiVersion": "openebs.io/v1alpha1",
+			"metadata": map[string]interface{}{
+				"name":      "onlyone-b",
+				"namespace": "default",
+			},
+			"spec": map[string]interface{}{
+				"id":      123,
+				"unknown": "field",
+			},
+		},
+	}
+	err := c.Test()
+	if err == nil {
+		t.Fatalf("test failed: expected error got nil")
+	}
+	if !strings.Contains(err.Error(), "getAndDecodeB failed: expected only mistyped spec.id") ||
+		!strings.Contains(err.Error(), "dropped spec.unknown") {
+		t.Fatalf("test failed: expected dropped field to fail the step got %v", err)
+	}
+}
+
+func TestTestAMatchesWholeObject(t *testing.T) {
+	client := kgs.NewFakeDynClientOrDie()
+	c := NewTestA(WithClient(client))
+	run(t, c.createNamespace, c.createCRD, c.createA, c.getAndMatchA)
+
+	// a field outside spec, status & labels is changed
+	got, err := client.Get(context.Background(), c.resGVK, c.resNamespace, c.resourceA.GetName())
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	got.SetAnnotations(map[string]string{"drift": "true"})
+	_, err = client.Update(context.Background(), c.resGVK, c.resNamespace, got)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	err = c.getAndMatchA(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "failed match") {
+		t.Fatalf("test failed: expected failed match got %v", err)
+	}
+}
+
+func TestVerifyNoResInstancesWaitsForCRDCleanup(t *testing.T) {
+	c := NewTestA(WithClient(kgs.NewFakeDynClientOrDie()))
+	run(t, c.createNamespace, c.createCRD, c.createA)
+
+	// crd is not deleted & hence its instance remains
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := c.verifyNoResInstances(ctx)
+	if err == nil || !strings.Contains(err.Error(), "1 onlyones remain") {
+		t.Fatalf("test failed: expected remaining instance got %v", err)
+	}
+	run(t, c.deleteCRD, c.verifyNoResInstances)
+}
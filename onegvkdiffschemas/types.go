@@ -29,7 +29,7 @@ var crdInst *unstructured.Unstructured = &unstructured.Unstructured{
 var resourceInstA *unstructured.Unstructured = &unstructured.Unstructured{
 	Object: map[string]interface{}{
 		"kind":       "Onlyone",
-		"apiVersion": "v1alpha1",
+		"apiVersion": "openebs.io/v1alpha1",
 		"metadata": map[string]interface{}{
 			"name":      "onlyone-a",
 			"namespace": "default",
@@ -51,7 +51,7 @@ var resourceInstA *unstructured.Unstructured = &unstructured.Unstructured{
 var resourceInstB *unstructured.Unstructured = &unstructured.Unstructured{
 	Object: map[string]interface{}{
 		"kind":       "Onlyone",
-		"apiVersion": "v1alpha1",
+		"apiVersion": "openebs.io/v1alpha1",
 		"metadata": map[string]interface{}{
 			"name":      "onlyone-b",
 			"namespace": "default",
@@ -0,0 +1,261 @@
+package kgetset
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ObjectRef identifies an object at K8s
+type ObjectRef struct {
+	GVK       schema.GroupVersionKind
+	Namespace string
+	Name      string
+}
+
+// RefOf returns the reference of the provided object
+func RefOf(obj *unstructured.Unstructured) ObjectRef {
+	return ObjectRef{
+		GVK:       obj.GroupVersionKind(),
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+	}
+}
+
+// String implements Stringer interface
+func (r ObjectRef) String() string {
+	if r.Namespace == "" {
+		return fmt.Sprintf("%s %q", r.GVK.Kind, r.Name)
+	}
+	return fmt.Sprintf("%s %q", r.GVK.Kind, r.Namespace+"/"+r.Name)
+}
+
+// SetOwnerReference makes the provided dependent object owned
+// by the provided owner object. An existing reference to the
+// owner is replaced.
+//
+// NOTE:
+//  Owner must have been fetched from K8s since the reference
+// holds its uid. Reference blocks the owner's deletion so that
+// a foreground deletion waits for the dependent.
+func SetOwnerReference(dependent, owner *unstructured.Unstructured, controller bool) error {
+	if owner.GetUID() == "" {
+		return errors.Errorf(
+			"failed to set owner %q of %q: owner has no uid",
+			owner.GetName(),
+			dependent.GetName(),
+		)
+	}
+	// K8s ignores owners of other namespaces
+	if owner.GetNamespace() != "" && owner.GetNamespace() != dependent.GetNamespace() {
+		return errors.Errorf(
+			"failed to set owner %q of %q: owner namespace %q differs from %q",
+			owner.GetName(),
+			dependent.GetName(),
+			owner.GetNamespace(),
+			dependent.GetNamespace(),
+		)
+	}
+	block := true
+	ref := metav1.OwnerReference{
+		APIVersion:         owner.GetAPIVersion(),
+		Kind:               owner.GetKind(),
+		Name:               owner.GetName(),
+		UID:                owner.GetUID(),
+		BlockOwnerDeletion: &block,
+	}
+	if controller {
+		ref.Controller = &controller
+	}
+	var refs []metav1.OwnerReference
+	for _, r := range dependent.GetOwnerReferences() {
+		if r.UID != owner.GetUID() {
+			refs = append(refs, r)
+		}
+	}
+	dependent.SetOwnerReferences(append(refs, ref))
+	return nil
+}
+
+// SetOwner makes the provided dependent owned by the provided
+// owner at K8s. Both the objects must exist. The updated
+// dependent is returned.
+func (uc *DynClient) SetOwner(
+	ctx context.Context,
+	dependent ObjectRef,
+	owner ObjectRef,
+	controller bool,
+) (*unstructured.Unstructured, error) {
+	ownerObj, err := uc.Get(ctx, owner.GVK, owner.Namespace, owner.Name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to set owner %s of %s", owner, dependent)
+	}
+	return uc.updateObject(
+		ctx,
+		dependent.GVK,
+		dependent.Namespace,
+		dependent.Name,
+		func(obj *unstructured.Unstructured) (bool, error) {
+			return true, SetOwnerReference(obj, ownerObj, controller)
+		},
+	)
+}
+
+// ownedBy returns true if the provided object has an owner
+// reference with the provided uid
+func ownedBy(obj *unstructured.Unstructured, uid types.UID) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyDeletionPropagation deletes the provided owner with
+// the provided propagation policy & verifies what happened to
+// the provided dependents
+//
+// NOTE:
+//  With foreground policy the owner must outlive each of its
+// dependents. With background policy the owner & then its
+// dependents must be deleted. Dependents are garbage collected
+// once the owner is gone but the moment of their deletion can
+// not be observed reliably. With orphan policy dependents must
+// remain without a reference to the owner.
+func (uc *DynClient) VerifyDeletionPropagation(
+	ctx context.Context,
+	owner ObjectRef,
+	policy metav1.DeletionPropagation,
+	dependents []ObjectRef,
+	options ...func(*WaitConfig),
+) error {
+	ownerObj, err := uc.Get(ctx, owner.GVK, owner.Namespace, owner.Name)
+	if err != nil {
+		return errors.Wrapf(err, "failed to verify %s deletion of %s", policy, owner)
+	}
+	err = uc.Delete(
+		ctx,
+		owner.GVK,
+		owner.Namespace,
+		owner.Name,
+		&metav1.DeleteOptions{PropagationPolicy: &policy},
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to verify %s deletion of %s", policy, owner)
+	}
+
+	switch policy {
+	case metav1.DeletePropagationForeground:
+		err = uc.verifyForeground(ctx, owner, dependents, options...)
+	case metav1.DeletePropagationOrphan:
+		err = uc.verifyOrphaned(ctx, owner, ownerObj.GetUID(), dependents, options...)
+	default:
+		err = uc.verifyDeleted(ctx, append([]ObjectRef{owner}, dependents...), options...)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to verify %s deletion of %s", policy, owner)
+	}
+	fmt.Printf("verified %s deletion of %s with %d dependents\n", policy, owner, len(dependents))
+	return nil
+}
+
+// verifyDeleted waits for the provided objects to be deleted
+func (uc *DynClient) verifyDeleted(
+	ctx context.Context,
+	refs []ObjectRef,
+	options ...func(*WaitConfig),
+) error {
+	for _, ref := range refs {
+		err := uc.WaitForDeletion(ctx, ref.GVK, ref.Namespace, ref.Name, options...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyForeground verifies that the owner being deleted in
+// foreground outlives each of its dependents
+func (uc *DynClient) verifyForeground(
+	ctx context.Context,
+	owner ObjectRef,
+	dependents []ObjectRef,
+	options ...func(*WaitConfig),
+) error {
+	for _, dep := range dependents {
+		dep := dep
+		var violated bool
+		err := WaitFor(
+			ctx,
+			func(ctx context.Context) (bool, error) {
+				// owner is checked first since a dependent found
+				// afterwards existed when the owner was gone
+				ownerDeleted, err := uc.Deleted(owner.GVK, owner.Namespace, owner.Name)(ctx)
+				if err != nil {
+					return false, err
+				}
+				deleted, err := uc.Deleted(dep.GVK, dep.Namespace, dep.Name)(ctx)
+				if err != nil {
+					return false, err
+				}
+				if ownerDeleted && !deleted {
+					violated = true
+					return false, errors.Errorf("owner got deleted before its dependent %s", dep)
+				}
+				return deleted, nil
+			},
+			options...,
+		)
+		if violated {
+			return err
+		}
+		if err != nil {
+			return uc.diagnoseDeletion(ctx, dep.GVK, dep.Namespace, dep.Name, err)
+		}
+	}
+	return uc.verifyDeleted(ctx, []ObjectRef{owner}, options...)
+}
+
+// verifyOrphaned verifies that the dependents remain without
+// a reference to the owner with the provided uid once the
+// owner is deleted
+func (uc *DynClient) verifyOrphaned(
+	ctx context.Context,
+	owner ObjectRef,
+	ownerUID types.UID,
+	dependents []ObjectRef,
+	options ...func(*WaitConfig),
+) error {
+	err := uc.WaitForDeletion(ctx, owner.GVK, owner.Namespace, owner.Name, options...)
+	if err != nil {
+		return err
+	}
+	for _, dep := range dependents {
+		dep := dep
+		err := WaitFor(
+			ctx,
+			func(ctx context.Context) (bool, error) {
+				obj, err := uc.Get(ctx, dep.GVK, dep.Namespace, dep.Name)
+				if err != nil {
+					return false, err
+				}
+				return !ownedBy(obj, ownerUID), nil
+			},
+			options...,
+		)
+		if k8serrors.IsNotFound(errors.Cause(err)) {
+			return errors.Errorf("dependent %s got deleted instead of orphaned", dep)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "dependent %s is still owned", dep)
+		}
+	}
+	return nil
+}
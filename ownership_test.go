@@ -0,0 +1,263 @@
+package kgetset
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+)
+
+// propagatingServer serves an owner named owner & its
+// dependents in the default namespace. Once the owner is
+// deleted each read completes the next deletion of its order.
+type propagatingServer struct {
+	mu         sync.Mutex
+	order      []string
+	orphaned   bool
+	finalizers map[string][]string
+	deleted    bool
+	gone       map[string]bool
+	policy     metav1.DeletionPropagation
+}
+
+// ServeHTTP implements http.Handler
+func (s *propagatingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := path.Base(r.URL.Path)
+	switch r.Method {
+	case http.MethodDelete:
+		options := metav1.DeleteOptions{}
+		body, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &options)
+		if options.PropagationPolicy != nil {
+			s.policy = *options.PropagationPolicy
+		}
+		s.deleted = name == "owner"
+		writeJSON(w, metav1.Status{Status: metav1.StatusSuccess})
+		return
+	case http.MethodGet:
+		if s.deleted && len(s.order) > 0 {
+			s.gone[s.order[0]] = true
+			s.order = s.order[1:]
+		}
+	}
+	if s.gone[name] {
+		writeNotFound(w)
+		return
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("openebs.io/v1")
+	obj.SetKind("Hello")
+	obj.SetNamespace("default")
+	obj.SetName(name)
+	obj.SetUID(types.UID("uid-" + name))
+	obj.SetFinalizers(s.finalizers[name])
+	if name != "owner" && !(s.orphaned && s.gone["owner"]) {
+		obj.SetOwnerReferences([]metav1.OwnerReference{
+			{APIVersion: "openebs.io/v1", Kind: "Hello", Name: "owner", UID: "uid-owner"},
+		})
+	}
+	writeJSON(w, obj.Object)
+}
+
+func TestDeletionPropagation(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "openebs.io", Version: "v1", Kind: "Hello"}
+	shortWait := []func(*WaitConfig){
+		WithWaitTimeout(50 * time.Millisecond),
+		WithWaitInterval(10 * time.Millisecond),
+	}
+	var tests = map[string]struct {
+		policy      metav1.DeletionPropagation
+		order       []string
+		orphaned    bool
+		finalizers  map[string][]string
+		isErr       bool
+		errContains string
+	}{
+		"foreground": {
+			policy: metav1.DeletePropagationForeground,
+			order:  []string{"dep-1", "dep-2", "owner"},
+		},
+		"background": {
+			policy: metav1.DeletePropagationBackground,
+			order:  []string{"owner", "dep-1", "dep-2"},
+		},
+		"orphan": {
+			policy:   metav1.DeletePropagationOrphan,
+			order:    []string{"owner"},
+			orphaned: true,
+		},
+		"foreground blocked by finalizer of dependent": {
+			policy:      metav1.DeletePropagationForeground,
+			order:       []string{"dep-2"},
+			finalizers:  map[string][]string{"dep-1": {"openebs.io/hold"}},
+			isErr:       true,
+			errContains: "finalizers [openebs.io/hold]",
+		},
+		"foreground deletes owner first": {
+			policy:      metav1.DeletePropagationForeground,
+			order:       []string{"owner"},
+			isErr:       true,
+			errContains: "owner got deleted before its dependent",
+		},
+		"background leaves dependent": {
+			policy:      metav1.DeletePropagationBackground,
+			order:       []string{"owner", "dep-2"},
+			isErr:       true,
+			errContains: "Hello \"dep-1\"",
+		},
+		"orphan deletes dependent": {
+			policy:      metav1.DeletePropagationOrphan,
+			order:       []string{"owner", "dep-1"},
+			orphaned:    true,
+			isErr:       true,
+			errContains: "got deleted instead of orphaned",
+		},
+		"orphan keeps owner reference": {
+			policy:      metav1.DeletePropagationOrphan,
+			order:       []string{"owner"},
+			isErr:       true,
+			errContains: "is still owned",
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			hellos := &propagatingServer{
+				order:      mock.order,
+				orphaned:   mock.orphaned,
+				finalizers: mock.finalizers,
+				gone:       map[string]bool{},
+			}
+			server := newTestServer(map[string]http.HandlerFunc{
+				"/apis/openebs.io/v1/namespaces/default/hellos/": hellos.ServeHTTP,
+			})
+			defer server.Close()
+			client, err := NewDynClientForConfig(
+				&rest.Config{Host: server.URL},
+				WithRetryPolicy(NoRetryPolicy),
+			)
+			if err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+			var refs []ObjectRef
+			for _, n := range []string{"owner", "dep-1", "dep-2"} {
+				refs = append(refs, ObjectRef{GVK: gvk, Namespace: "default", Name: n})
+			}
+
+			err = client.VerifyDeletionPropagation(
+				context.Background(), refs[0], mock.policy, refs[1:], shortWait...,
+			)
+			hellos.mu.Lock()
+			defer hellos.mu.Unlock()
+			if hellos.policy != mock.policy {
+				t.Fatalf("test failed: expected %s policy to be sent got %q", mock.policy, hellos.policy)
+			}
+			if mock.isErr {
+				if err == nil || !strings.Contains(err.Error(), mock.errContains) {
+					t.Fatalf("test failed: expected error with %q got %v", mock.errContains, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+		})
+	}
+}
+
+func TestSetOwnerReference(t *testing.T) {
+	newObj := func(namespace, name, uid string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("openebs.io/v1")
+		obj.SetKind("Hello")
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		obj.SetUID(types.UID(uid))
+		return obj
+	}
+	var tests = map[string]struct {
+		dependent    *unstructured.Unstructured
+		owner        *unstructured.Unstructured
+		existing     []metav1.OwnerReference
+		controller   bool
+		expectedUIDs []types.UID
+		isErr        bool
+	}{
+		"owner without uid": {
+			dependent: newObj("default", "dep", "2"),
+			owner:     newObj("default", "owner", ""),
+			isErr:     true,
+		},
+		"owner of another namespace": {
+			dependent: newObj("default", "dep", "2"),
+			owner:     newObj("other", "owner", "1"),
+			isErr:     true,
+		},
+		"cluster scoped owner": {
+			dependent:    newObj("default", "dep", "2"),
+			owner:        newObj("", "owner", "1"),
+			expectedUIDs: []types.UID{"1"},
+		},
+		"other owners are kept": {
+			dependent:    newObj("default", "dep", "2"),
+			owner:        newObj("default", "owner", "1"),
+			existing:     []metav1.OwnerReference{{Kind: "Hello", Name: "other", UID: "3"}},
+			expectedUIDs: []types.UID{"3", "1"},
+		},
+		"existing reference is replaced": {
+			dependent:    newObj("default", "dep", "2"),
+			owner:        newObj("default", "owner", "1"),
+			existing:     []metav1.OwnerReference{{Kind: "Hello", Name: "owner", UID: "1"}},
+			controller:   true,
+			expectedUIDs: []types.UID{"1"},
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			mock.dependent.SetOwnerReferences(mock.existing)
+			err := SetOwnerReference(mock.dependent, mock.owner, mock.controller)
+			if mock.isErr {
+				if err == nil {
+					t.Fatalf("test failed: expected error got nil")
+				}
+				if len(mock.dependent.GetOwnerReferences()) != 0 {
+					t.Fatalf("test failed: expected no owner references got %+v", mock.dependent.GetOwnerReferences())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+			refs := mock.dependent.GetOwnerReferences()
+			var uids []types.UID
+			for _, r := range refs {
+				uids = append(uids, r.UID)
+			}
+			if !reflect.DeepEqual(uids, mock.expectedUIDs) {
+				t.Fatalf("test failed: expected owner uids %v got %v", mock.expectedUIDs, uids)
+			}
+			last := refs[len(refs)-1]
+			if last.BlockOwnerDeletion == nil || !*last.BlockOwnerDeletion {
+				t.Fatalf("test failed: expected reference to block owner deletion")
+			}
+			if (last.Controller != nil && *last.Controller) != mock.controller {
+				t.Fatalf("test failed: expected controller %t got %v", mock.controller, last.Controller)
+			}
+		})
+	}
+}
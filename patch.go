@@ -0,0 +1,202 @@
+package kgetset
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// JSONPatchOp is an operation of a RFC 6902 json patch
+//
+// NOTE:
+//  Path & From are json pointers e.g. /spec/items/0
+type JSONPatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+// MarshalJSON implements json.Marshaler
+//
+// NOTE:
+//  Value is sent for add, replace & test operations even if it
+// is nil since RFC 6902 requires it. It is never sent for the
+// other operations.
+func (o JSONPatchOp) MarshalJSON() ([]byte, error) {
+	op := map[string]interface{}{"op": o.Op, "path": o.Path}
+	switch o.Op {
+	case "add", "replace", "test":
+		op["value"] = o.Value
+	case "move", "copy":
+		op["from"] = o.From
+	}
+	return json.Marshal(op)
+}
+
+// AddOp adds the provided value at the provided path. A path
+// ending with /- appends to the list.
+func AddOp(path string, value interface{}) JSONPatchOp {
+	return JSONPatchOp{Op: "add", Path: path, Value: value}
+}
+
+// RemoveOp removes the value at the provided path
+func RemoveOp(path string) JSONPatchOp {
+	return JSONPatchOp{Op: "remove", Path: path}
+}
+
+// ReplaceOp replaces the value at the provided path
+func ReplaceOp(path string, value interface{}) JSONPatchOp {
+	return JSONPatchOp{Op: "replace", Path: path, Value: value}
+}
+
+// MoveOp moves the value at from to the provided path
+func MoveOp(from, path string) JSONPatchOp {
+	return JSONPatchOp{Op: "move", From: from, Path: path}
+}
+
+// CopyOp copies the value at from to the provided path
+func CopyOp(from, path string) JSONPatchOp {
+	return JSONPatchOp{Op: "copy", From: from, Path: path}
+}
+
+// TestOp fails the patch if the value at the provided path
+// is not the provided value
+func TestOp(path string, value interface{}) JSONPatchOp {
+	return JSONPatchOp{Op: "test", Path: path, Value: value}
+}
+
+// JSONPatch patches the object with the provided name with a
+// RFC 6902 json patch made of the provided operations
+func (uc *DynClient) JSONPatch(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	ops ...JSONPatchOp,
+) (*unstructured.Unstructured, error) {
+	if len(ops) == 0 {
+		return nil, errors.Errorf("failed to json patch %q: no operations", name)
+	}
+	data, err := json.Marshal(ops)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to json patch %q", name)
+	}
+	return uc.Patch(ctx, gvk, namespace, name, types.JSONPatchType, data)
+}
+
+// MergePatch patches the object with the provided name with a
+// RFC 7386 merge patch built from the provided value
+//
+// NOTE:
+//  A merge patch replaces lists as a whole & removes fields
+// set to null
+func (uc *DynClient) MergePatch(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	patch interface{},
+) (*unstructured.Unstructured, error) {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to merge patch %q", name)
+	}
+	return uc.Patch(ctx, gvk, namespace, name, types.MergePatchType, data)
+}
+
+// ApplyPatch patches the object with the provided name with an
+// apply patch built from the provided value. Fields set by the
+// patch are owned by the provided field manager.
+//
+// NOTE:
+//  Patch must be a fully specified object i.e. have its
+// apiVersion, kind & name
+func (uc *DynClient) ApplyPatch(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	patch interface{},
+	fieldManager string,
+	force bool,
+) (*unstructured.Unstructured, error) {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to apply patch %q", name)
+	}
+	if fieldManager == "" {
+		fieldManager = DefaultFieldManager
+	}
+	options := metav1.PatchOptions{FieldManager: fieldManager}
+	if force {
+		options.Force = &force
+	}
+	return uc.patch(ctx, gvk, namespace, name, types.ApplyPatchType, data, options)
+}
+
+// PatchFromFile patches the object with the provided name with
+// the patch read from the provided file. File can be yaml or
+// json.
+//
+// NOTE:
+//  If patch type is not set a list is sent as json patch &
+// anything else as merge patch
+func (uc *DynClient) PatchFromFile(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	pt types.PatchType,
+	path string,
+) (*unstructured.Unstructured, error) {
+	data, pt, err := ReadPatchFile(path, pt)
+	if err != nil {
+		return nil, err
+	}
+	if pt == types.ApplyPatchType {
+		return uc.patch(
+			ctx,
+			gvk,
+			namespace,
+			name,
+			pt,
+			data,
+			metav1.PatchOptions{FieldManager: DefaultFieldManager},
+		)
+	}
+	return uc.Patch(ctx, gvk, namespace, name, pt, data)
+}
+
+// ReadPatchFile returns the json patch read from the provided
+// yaml or json file along with its patch type. Patch type is
+// detected if the provided one is empty.
+func ReadPatchFile(path string, pt types.PatchType) ([]byte, types.PatchType, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to read patch file %q", path)
+	}
+	data, err := yaml.ToJSON(raw)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to read patch file %q", path)
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil, "", errors.Errorf("failed to read patch file %q: empty patch", path)
+	}
+	if pt == "" {
+		pt = types.MergePatchType
+		if data[0] == '[' {
+			pt = types.JSONPatchType
+		}
+	}
+	return data, pt, nil
+}
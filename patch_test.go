@@ -0,0 +1,209 @@
+package kgetset
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+)
+
+func TestJSONPatchOpMarshal(t *testing.T) {
+	var tests = map[string]struct {
+		op       JSONPatchOp
+		expected string
+	}{
+		"add nil": {
+			op:       AddOp("/spec/desc", nil),
+			expected: `{"op":"add","path":"/spec/desc","value":null}`,
+		},
+		"replace nil": {
+			op:       ReplaceOp("/spec/desc", nil),
+			expected: `{"op":"replace","path":"/spec/desc","value":null}`,
+		},
+		"test nil": {
+			op:       TestOp("/spec/desc", nil),
+			expected: `{"op":"test","path":"/spec/desc","value":null}`,
+		},
+		"add value": {
+			op:       AddOp("/spec/items/-", "a"),
+			expected: `{"op":"add","path":"/spec/items/-","value":"a"}`,
+		},
+		"remove": {
+			op:       RemoveOp("/spec/desc"),
+			expected: `{"op":"remove","path":"/spec/desc"}`,
+		},
+		"move": {
+			op:       MoveOp("/spec/a", "/spec/b"),
+			expected: `{"from":"/spec/a","op":"move","path":"/spec/b"}`,
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			got, err := json.Marshal(mock.op)
+			if err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+			if string(got) != mock.expected {
+				t.Fatalf("test failed: expected %s got %s", mock.expected, got)
+			}
+		})
+	}
+}
+
+// TestApplyPatch verifies the apply patch sent by DynClient
+func TestApplyPatch(t *testing.T) {
+	var mu sync.Mutex
+	var contentType string
+	var query url.Values
+	var sent map[string]interface{}
+	server := newTestServer(map[string]http.HandlerFunc{
+		"/apis/openebs.io/v1/namespaces/default/hellos/my-hello": func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			if r.Method != http.MethodPatch {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			contentType = r.Header.Get("Content-Type")
+			query = r.URL.Query()
+			body, _ := ioutil.ReadAll(r.Body)
+			_ = json.Unmarshal(body, &sent)
+			// applied object is returned as is
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(body)
+		},
+	})
+	defer server.Close()
+
+	client, err := NewDynClientForConfig(
+		&rest.Config{Host: server.URL},
+		WithRetryPolicy(NoRetryPolicy),
+	)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	gvk := schema.GroupVersionKind{Group: "openebs.io", Version: "v1", Kind: "Hello"}
+	_, err = client.ApplyPatch(
+		context.Background(), gvk, "default", "my-hello",
+		map[string]interface{}{
+			"apiVersion": "openebs.io/v1",
+			"kind":       "Hello",
+			"metadata":   map[string]interface{}{"name": "my-hello"},
+			"spec":       map[string]interface{}{"items": []string{"c"}},
+		},
+		"", false,
+	)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if contentType != string(types.ApplyPatchType) {
+		t.Fatalf("test failed: expected apply patch got content type %q", contentType)
+	}
+	if query.Get("fieldManager") != DefaultFieldManager || query.Get("force") != "" {
+		t.Fatalf("test failed: expected default field manager without force got query %v", query)
+	}
+	items, _, _ := unstructured.NestedSlice(sent, "spec", "items")
+	if sent["kind"] != "Hello" || !reflect.DeepEqual(items, []interface{}{"c"}) {
+		t.Fatalf("test failed: expected apply patch of Hello with items [c] got %v", sent)
+	}
+	entries := client.Transcript().Entries()
+	last := entries[len(entries)-1]
+	if last.Verb != "patch" || last.Error != "" {
+		t.Fatalf("test failed: expected apply patch in transcript got %+v", last)
+	}
+}
+
+func TestPatchListSemantics(t *testing.T) {
+	ctx := context.Background()
+	gvk := schema.GroupVersionKind{Group: "openebs.io", Version: "v1", Kind: "Hello"}
+	client := NewFakeDynClientOrDie(newTestCRD("openebs.io", "hellos", "Hello", nil, nil))
+	_, err := client.Create(ctx, gvk, "default", &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "openebs.io/v1",
+			"kind":       "Hello",
+			"metadata":   map[string]interface{}{"name": "my-hello", "namespace": "default"},
+			"spec": map[string]interface{}{
+				"items": []interface{}{"a", "b"},
+				"desc":  "hi",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+
+	expectItems := func(obj *unstructured.Unstructured, expected ...interface{}) {
+		got, _, _ := unstructured.NestedSlice(obj.Object, "spec", "items")
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("test failed: expected items %v got %v", expected, got)
+		}
+	}
+
+	// json patch works on list elements
+	got, err := client.JSONPatch(
+		ctx, gvk, "default", "my-hello",
+		TestOp("/spec/items/0", "a"),
+		AddOp("/spec/items/-", "c"),
+		RemoveOp("/spec/items/0"),
+	)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	expectItems(got, "b", "c")
+
+	// merge patch replaces the list as a whole
+	got, err = client.MergePatch(
+		ctx, gvk, "default", "my-hello",
+		map[string]interface{}{
+			"spec": map[string]interface{}{"items": []string{"d"}, "desc": nil},
+		},
+	)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	expectItems(got, "d")
+	if _, found, _ := unstructured.NestedString(got.Object, "spec", "desc"); found {
+		t.Fatalf("test failed: expected desc to be removed")
+	}
+
+	// failed test op rejects the patch
+	_, err = client.JSONPatch(ctx, gvk, "default", "my-hello", TestOp("/spec/items/0", "z"))
+	if err == nil {
+		t.Fatalf("test failed: expected error got nil")
+	}
+
+	dir, err := ioutil.TempDir("", "kgetset")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "patch.yaml")
+	err = ioutil.WriteFile(path, []byte("- op: add\n  path: /spec/items/0\n  value: e\n"), 0600)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	_, pt, err := ReadPatchFile(path, "")
+	if err != nil || pt != types.JSONPatchType {
+		t.Fatalf("test failed: expected json patch got %q: %v", pt, err)
+	}
+	got, err = client.PatchFromFile(ctx, gvk, "default", "my-hello", "", path)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	expectItems(got, "e", "d")
+}
@@ -0,0 +1,135 @@
+package kgetset
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/rest"
+)
+
+// Operation is an api call made with the provided client
+type Operation func(ctx context.Context, client *DynClient) error
+
+// Impersonate returns a new client that makes its api calls
+// as the provided user & groups
+//
+// NOTE:
+//  The new client shares the rest mapper & transcript of this
+// client. Kinds are hence discovered with this client's
+// identity.
+//
+// NOTE:
+//  A fake client does not enforce RBAC. Its impersonating
+// clients only differ in the user recorded in the transcript.
+func (uc *DynClient) Impersonate(user string, groups ...string) (*DynClient, error) {
+	if user == "" {
+		return nil, errors.Errorf("failed to impersonate: empty user")
+	}
+	derived := uc.derive()
+	derived.identity = user
+	if uc.config == nil {
+		return derived, nil
+	}
+
+	config := rest.CopyConfig(uc.config)
+	config.Impersonate = rest.ImpersonationConfig{
+		UserName: user,
+		Groups:   groups,
+	}
+	dyn, watchDyn, err := newDynamicClients(config, uc.timeout)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to impersonate %q", user)
+	}
+	derived.dynamic = dyn
+	derived.watchDynamic = watchDyn
+	derived.config = config
+	return derived, nil
+}
+
+// ImpersonateServiceAccount returns a new client that makes
+// its api calls as the provided service account
+func (uc *DynClient) ImpersonateServiceAccount(namespace, name string) (*DynClient, error) {
+	return uc.Impersonate(
+		fmt.Sprintf("system:serviceaccount:%s:%s", namespace, name),
+		"system:serviceaccounts",
+		"system:serviceaccounts:"+namespace,
+	)
+}
+
+// Identity returns the user impersonated by this client. It
+// is empty if this client does not impersonate.
+func (uc *DynClient) Identity() string {
+	return uc.identity
+}
+
+// identityName returns a printable name of the client's
+// identity
+func (uc *DynClient) identityName() string {
+	if uc.identity == "" {
+		return "default identity"
+	}
+	return fmt.Sprintf("%q", uc.identity)
+}
+
+// ExpectForbidden returns a test step that passes only if the
+// provided operation is forbidden for the client's identity
+func ExpectForbidden(client *DynClient, op Operation) func(context.Context) error {
+	return func(ctx context.Context) error {
+		err := op(ctx, client)
+		if err == nil {
+			return errors.Errorf(
+				"expected forbidden got allowed: %s",
+				client.identityName(),
+			)
+		}
+		if !k8serrors.IsForbidden(errors.Cause(err)) {
+			return errors.Wrapf(
+				err,
+				"expected forbidden: %s",
+				client.identityName(),
+			)
+		}
+		return nil
+	}
+}
+
+// ExpectAllowed returns a test step that passes only if the
+// provided operation succeeds for the client's identity
+func ExpectAllowed(client *DynClient, op Operation) func(context.Context) error {
+	return func(ctx context.Context) error {
+		err := op(ctx, client)
+		if err != nil {
+			return errors.Wrapf(
+				err,
+				"expected allowed: %s",
+				client.identityName(),
+			)
+		}
+		return nil
+	}
+}
+
+// ExpectAllowedOnly returns a test step that passes only if
+// the provided operation succeeds for the allowed client &
+// is forbidden for each of the other clients
+func ExpectAllowedOnly(
+	allowed *DynClient,
+	op Operation,
+	forbidden ...*DynClient,
+) func(context.Context) error {
+	fns := []func(context.Context) error{ExpectAllowed(allowed, op)}
+	for _, f := range forbidden {
+		fns = append(fns, ExpectForbidden(f, op))
+	}
+	return func(ctx context.Context) error {
+		for _, fn := range fns {
+			err := fn(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,77 @@
+package kgetset
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+func TestImpersonateServiceAccount(t *testing.T) {
+	client, err := NewDynClientForConfig(&rest.Config{Host: "https://127.0.0.1:6443"})
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	sa, err := client.ImpersonateServiceAccount("default", "reader")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if sa.config.Impersonate.UserName != "system:serviceaccount:default:reader" {
+		t.Fatalf("test failed: got user %q", sa.config.Impersonate.UserName)
+	}
+	if len(sa.config.Impersonate.Groups) != 2 {
+		t.Fatalf("test failed: expected 2 groups got %v", sa.config.Impersonate.Groups)
+	}
+	if client.config.Impersonate.UserName != "" {
+		t.Fatalf("test failed: base client impersonates %q", client.config.Impersonate.UserName)
+	}
+}
+
+func TestExpectAllowedOnly(t *testing.T) {
+	gr := schema.GroupResource{Group: "openebs.io", Resource: "hellos"}
+	op := func(ctx context.Context, client *DynClient) error {
+		if client.Identity() != "admin" {
+			return errors.Wrapf(
+				k8serrors.NewForbidden(gr, "my-hello", errors.New("rbac")),
+				"failed to get",
+			)
+		}
+		return nil
+	}
+	base := NewFakeDynClientOrDie()
+	admin, err := base.Impersonate("admin", "system:masters")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	guest, err := base.Impersonate("guest")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+
+	ctx := context.Background()
+	err = ExpectAllowedOnly(admin, op, guest, base)(ctx)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	err = ExpectAllowedOnly(guest, op, admin)(ctx)
+	if err == nil {
+		t.Fatalf("test failed: expected error got nil")
+	}
+	err = ExpectForbidden(admin, op)(ctx)
+	if err == nil {
+		t.Fatalf("test failed: expected error got nil")
+	}
+
+	// operation gets the context of the step
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = ExpectAllowed(admin, func(ctx context.Context, _ *DynClient) error {
+		return ctx.Err()
+	})(cancelled)
+	if errors.Cause(err) != context.Canceled {
+		t.Fatalf("test failed: expected canceled got %v", err)
+	}
+}
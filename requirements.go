@@ -0,0 +1,120 @@
+package kgetset
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// Requirements are the cluster features a suite or a step
+// needs to be applicable
+type Requirements struct {
+	// MinVersion is the lowest server version e.g. 1.16
+	MinVersion string
+
+	// MaxVersion is the highest server version e.g. 1.21 that
+	// includes all its patch versions
+	MaxVersion string
+
+	// APIGroupVersions must be served by K8s e.g.
+	// apiextensions.k8s.io/v1 or v1 for the core group
+	APIGroupVersions []string
+}
+
+// IsEmpty returns true if nothing is required
+func (r Requirements) IsEmpty() bool {
+	return r.MinVersion == "" && r.MaxVersion == "" && len(r.APIGroupVersions) == 0
+}
+
+// RequirementsChecker checks if the cluster meets requirements
+//
+// NOTE:
+//  DynClient is a requirements checker
+type RequirementsChecker interface {
+	// CheckRequirements returns the reason why the provided
+	// requirements are not met. Reason is empty if these are
+	// met.
+	CheckRequirements(r Requirements) (string, error)
+}
+
+// ServerVersion returns the version of the API server
+func (uc *DynClient) ServerVersion() (*version.Version, error) {
+	info, err := uc.discovery.ServerVersion()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get server version")
+	}
+	v, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse server version %q", info.GitVersion)
+	}
+	return v, nil
+}
+
+// CheckRequirements implements RequirementsChecker interface
+func (uc *DynClient) CheckRequirements(r Requirements) (string, error) {
+	if r.MinVersion != "" || r.MaxVersion != "" {
+		server, err := uc.ServerVersion()
+		if err != nil {
+			return "", err
+		}
+		reason, err := checkVersion(server, r.MinVersion, r.MaxVersion)
+		if err != nil || reason != "" {
+			return reason, err
+		}
+	}
+	if len(r.APIGroupVersions) == 0 {
+		return "", nil
+	}
+	groups, err := uc.discovery.ServerGroups()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to discover api groups")
+	}
+	served := map[string]bool{}
+	for _, g := range groups.Groups {
+		for _, v := range g.Versions {
+			served[v.GroupVersion] = true
+		}
+	}
+	var missing []string
+	for _, gv := range r.APIGroupVersions {
+		if !served[gv] {
+			missing = append(missing, gv)
+		}
+	}
+	if len(missing) != 0 {
+		return fmt.Sprintf("api %s not served", strings.Join(missing, ", ")), nil
+	}
+	return "", nil
+}
+
+// checkVersion returns the reason why the provided server
+// version is not within the provided min & max versions
+func checkVersion(server *version.Version, min, max string) (string, error) {
+	if min != "" {
+		minVersion, err := version.ParseGeneric(min)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid min version %q", min)
+		}
+		if !server.AtLeast(minVersion) {
+			return fmt.Sprintf("server version %s is below %s", server, min), nil
+		}
+	}
+	if max != "" {
+		maxVersion, err := version.ParseGeneric(max)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid max version %q", max)
+		}
+		above := maxVersion.LessThan(server)
+		// max without a patch includes all its patches
+		if strings.Count(strings.TrimPrefix(max, "v"), ".") == 1 {
+			above = server.Major() > maxVersion.Major() ||
+				(server.Major() == maxVersion.Major() && server.Minor() > maxVersion.Minor())
+		}
+		if above {
+			return fmt.Sprintf("server version %s is above %s", server, max), nil
+		}
+	}
+	return "", nil
+}
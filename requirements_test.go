@@ -0,0 +1,116 @@
+package kgetset
+
+import (
+	"strings"
+	"testing"
+
+	apiversion "k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+)
+
+func TestCheckRequirements(t *testing.T) {
+	var tests = map[string]struct {
+		server       string
+		requirements Requirements
+		reason       string
+	}{
+		"no requirements": {
+			server: "v1.15.0",
+		},
+		"within versions": {
+			server:       "v1.21.3",
+			requirements: Requirements{MinVersion: "1.16", MaxVersion: "1.21"},
+		},
+		"below min version": {
+			server:       "v1.15.0",
+			requirements: Requirements{MinVersion: "1.16"},
+			reason:       "server version 1.15.0 is below 1.16",
+		},
+		"above max version": {
+			server:       "v1.22.0",
+			requirements: Requirements{MaxVersion: "1.21"},
+			reason:       "server version 1.22.0 is above 1.21",
+		},
+		"above max patch version": {
+			server:       "v1.21.3",
+			requirements: Requirements{MaxVersion: "1.21.2"},
+			reason:       "server version 1.21.3 is above 1.21.2",
+		},
+		"served api": {
+			server:       "v1.15.0",
+			requirements: Requirements{APIGroupVersions: []string{"apiextensions.k8s.io/v1beta1", "v1"}},
+		},
+		"api not served": {
+			server:       "v1.15.0",
+			requirements: Requirements{APIGroupVersions: []string{"batch/v2"}},
+			reason:       "api batch/v2 not served",
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			client := NewFakeDynClientOrDie()
+			client.discovery.(*fakediscovery.FakeDiscovery).FakedServerVersion = &apiversion.Info{
+				GitVersion: mock.server,
+			}
+			reason, err := client.CheckRequirements(mock.requirements)
+			if err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+			if reason != mock.reason {
+				t.Fatalf("test failed: expected reason %q got %q", mock.reason, reason)
+			}
+		})
+	}
+}
+
+func TestSkipNotApplicableTest(t *testing.T) {
+	client := NewFakeDynClientOrDie()
+	var ran bool
+	suite := &TestAbstract{
+		Observers: []StepObserver{client},
+		Requires:  Requirements{APIGroupVersions: []string{"apiextensions.k8s.io/v2"}},
+		Steps: []Step{
+			NewStep("run", func() error {
+				ran = true
+				return nil
+			}),
+		},
+	}
+	err := suite.Test()
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	result := suite.Result()
+	if ran || !result.Skipped || !strings.Contains(result.SkipReason, "apiextensions.k8s.io/v2") {
+		t.Fatalf("test failed: expected skipped test got ran=%t %+v", ran, result)
+	}
+}
+
+func TestSkipNotApplicableStep(t *testing.T) {
+	client := NewFakeDynClientOrDie()
+	var ran []string
+	step := func(name string) func() error {
+		return func() error {
+			ran = append(ran, name)
+			return nil
+		}
+	}
+	v2 := NewStep("v2", step("v2"))
+	v2.Requires = Requirements{APIGroupVersions: []string{"apiextensions.k8s.io/v2"}}
+	suite := &TestAbstract{
+		Observers: []StepObserver{client},
+		Steps:     []Step{NewStep("v1", step("v1")), v2},
+	}
+	err := suite.Test()
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if strings.Join(ran, " ") != "v1" {
+		t.Fatalf("test failed: expected only v1 to run got %v", ran)
+	}
+	steps := suite.Result().Steps
+	if len(steps) != 2 || !strings.Contains(steps[1].SkipReason, "apiextensions.k8s.io/v2") {
+		t.Fatalf("test failed: expected v2 to be skipped got %+v", steps)
+	}
+}
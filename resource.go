@@ -0,0 +1,144 @@
+package kgetset
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+// KindFor resolves the provided resource to its kind. Resource
+// can be a plural, singular or short name, a kind or a kubectl
+// style name qualified with version & group.
+//
+// NOTE:
+//  Following resolve to the same kind:
+//   hellos, hello, Hello, hellos.openebs.io, hellos.v1.openebs.io
+//
+// NOTE:
+//  A resource matching kinds of more than one group is
+// ambiguous & needs to be qualified with its group
+func (uc *DynClient) KindFor(resource string) (schema.GroupVersionKind, error) {
+	gvks, err := uc.KindsFor(resource)
+	if err != nil {
+		return schema.GroupVersionKind{}, err
+	}
+	if len(gvks) > 1 {
+		return schema.GroupVersionKind{}, ambiguityError(resource, gvks)
+	}
+	return gvks[0], nil
+}
+
+// KindsFor resolves the provided resource to its kinds. In
+// addition to the resources accepted by KindFor, a category
+// e.g. all resolves to the kinds of all its resources.
+//
+// NOTE:
+//  Only the server preferred version of a kind is returned
+// unless the version is part of the provided resource
+func (uc *DynClient) KindsFor(resource string) ([]schema.GroupVersionKind, error) {
+	resource = strings.ToLower(strings.TrimSpace(resource))
+	if resource == "" {
+		return nil, errors.Errorf("failed to resolve kind: empty resource")
+	}
+	var gvks []schema.GroupVersionKind
+	err := uc.withRediscovery("", resource, func() (err error) {
+		gvks, err = uc.kindsFor(resource)
+		return
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve kind of %q", resource)
+	}
+	return gvks, nil
+}
+
+// kindsFor resolves the provided resource in the order of
+// fully qualified resource, resource or short name & finally
+// category
+func (uc *DynClient) kindsFor(resource string) ([]schema.GroupVersionKind, error) {
+	mapper := restmapper.NewShortcutExpander(uc.mapper, uc.discovery)
+
+	full, gr := schema.ParseResourceArg(resource)
+	if full != nil {
+		gvk, err := mapper.KindFor(*full)
+		if err == nil {
+			return []schema.GroupVersionKind{gvk}, nil
+		}
+		if !meta.IsNoMatchError(err) {
+			return nil, err
+		}
+	}
+
+	gvks, err := mapper.KindsFor(gr.WithVersion(""))
+	if err == nil {
+		return preferredKinds(gvks), nil
+	}
+	if !meta.IsNoMatchError(err) {
+		return nil, err
+	}
+
+	grs, ok := restmapper.NewDiscoveryCategoryExpander(uc.discovery).Expand(resource)
+	if !ok {
+		return nil, err
+	}
+	gvks = nil
+	for _, r := range grs {
+		gvk, err := mapper.KindFor(r.WithVersion(""))
+		if err != nil {
+			return nil, err
+		}
+		gvks = append(gvks, gvk)
+	}
+	return preferredKinds(gvks), nil
+}
+
+// preferredKinds returns the first version of every group kind
+// in the provided kinds
+//
+// NOTE:
+//  Mapper returns the kinds in the order of server preference
+func preferredKinds(gvks []schema.GroupVersionKind) []schema.GroupVersionKind {
+	var preferred []schema.GroupVersionKind
+	seen := map[schema.GroupKind]bool{}
+	for _, gvk := range gvks {
+		if seen[gvk.GroupKind()] {
+			continue
+		}
+		seen[gvk.GroupKind()] = true
+		preferred = append(preferred, gvk)
+	}
+	return preferred
+}
+
+// ambiguityError returns an error listing the group kinds the
+// provided resource resolves to
+func ambiguityError(resource string, gvks []schema.GroupVersionKind) error {
+	var matches []string
+	for _, gvk := range gvks {
+		matches = append(matches, gvk.GroupKind().String())
+	}
+	sort.Strings(matches)
+	return errors.Errorf(
+		"ambiguous resource %q: matches %s: qualify with group e.g. %s.<group>",
+		resource,
+		strings.Join(matches, ", "),
+		resource,
+	)
+}
+
+// GetResourceInterfaceFor returns the dynamic interface of the
+// provided resource. Resource is resolved the way KindFor does.
+func (uc *DynClient) GetResourceInterfaceFor(
+	resource string,
+	ns ...string,
+) (dynamic.ResourceInterface, error) {
+	gvk, err := uc.KindFor(resource)
+	if err != nil {
+		return nil, err
+	}
+	return uc.GetResourceInterface(gvk, ns...)
+}
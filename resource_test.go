@@ -0,0 +1,85 @@
+package kgetset
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func newTestCRD(group, plural, kind string, shortNames, categories []interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apiextensions.k8s.io/v1beta1",
+			"kind":       "CustomResourceDefinition",
+			"metadata": map[string]interface{}{
+				"name": plural + "." + group,
+			},
+			"spec": map[string]interface{}{
+				"group":   group,
+				"version": "v1",
+				"scope":   "Namespaced",
+				"names": map[string]interface{}{
+					"plural":     plural,
+					"kind":       kind,
+					"shortNames": shortNames,
+					"categories": categories,
+				},
+			},
+		},
+	}
+}
+
+func TestKindFor(t *testing.T) {
+	hello := schema.GroupVersionKind{Group: "openebs.io", Version: "v1", Kind: "Hello"}
+	client := NewFakeDynClientOrDie(
+		newTestCRD("openebs.io", "hellos", "Hello", []interface{}{"hl"}, []interface{}{"openebs"}),
+		newTestCRD("openebs.io", "onlyones", "Onlyone", nil, []interface{}{"openebs"}),
+		newTestCRD("example.com", "hellos", "Hello", nil, nil),
+	)
+
+	var tests = map[string]struct {
+		resource string
+		expected schema.GroupVersionKind
+		isErr    bool
+	}{
+		"qualified plural":     {resource: "hellos.openebs.io", expected: hello},
+		"fully qualified":      {resource: "hellos.v1.openebs.io", expected: hello},
+		"qualified singular":   {resource: "hello.openebs.io", expected: hello},
+		"short name":           {resource: "hl", expected: hello},
+		"kind":                 {resource: "Onlyone", expected: hello.GroupVersion().WithKind("Onlyone")},
+		"namespace short name": {resource: "ns", expected: schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}},
+		"ambiguous plural":     {resource: "hellos", isErr: true},
+		"ambiguous category":   {resource: "openebs", isErr: true},
+		"unknown":              {resource: "byes", isErr: true},
+		"empty":                {resource: " ", isErr: true},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			got, err := client.KindFor(mock.resource)
+			if mock.isErr && err == nil {
+				t.Fatalf("test failed: expected error got %s", got)
+			}
+			if !mock.isErr && err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+			if got != mock.expected {
+				t.Fatalf("test failed: expected %s got %s", mock.expected, got)
+			}
+		})
+	}
+
+	_, err := client.KindFor("hellos")
+	if err == nil || !strings.Contains(err.Error(), "Hello.example.com, Hello.openebs.io") {
+		t.Fatalf("test failed: expected ambiguity listing both groups got %v", err)
+	}
+	gvks, err := client.KindsFor("openebs")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if len(gvks) != 2 {
+		t.Fatalf("test failed: expected 2 kinds got %v", gvks)
+	}
+}
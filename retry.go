@@ -0,0 +1,185 @@
+package kgetset
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// ErrorClass is the category of an api error that decides
+// if the api call can be retried
+type ErrorClass string
+
+const (
+	// ErrorClassNone is set for errors that are not retried
+	ErrorClassNone ErrorClass = ""
+
+	// ErrorClassConflict is set for 409 Conflict errors
+	//
+	// NOTE:
+	//  Resending a call that conflicts e.g. an update having a
+	// stale resource version or a server side apply without
+	// force conflicts again. Hence conflicts are not retried by
+	// default & are handled by fetching the object again e.g.
+	// by Apply.
+	ErrorClassConflict ErrorClass = "Conflict"
+
+	// ErrorClassThrottled is set for 429 TooManyRequests errors
+	ErrorClassThrottled ErrorClass = "Throttled"
+
+	// ErrorClassServerTimeout is set when API server times out
+	ErrorClassServerTimeout ErrorClass = "ServerTimeout"
+
+	// ErrorClassConnectionRefused is set when the connection to
+	// API server is refused or reset
+	ErrorClassConnectionRefused ErrorClass = "ConnectionRefused"
+)
+
+// ClassifyError returns the class of the provided error
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorClassNone
+	}
+	err = errors.Cause(err)
+	switch {
+	case k8serrors.IsConflict(err):
+		return ErrorClassConflict
+	case k8serrors.IsTooManyRequests(err):
+		return ErrorClassThrottled
+	case k8serrors.IsServerTimeout(err), k8serrors.IsTimeout(err):
+		return ErrorClassServerTimeout
+	case utilnet.IsConnectionRefused(err), utilnet.IsConnectionReset(err):
+		return ErrorClassConnectionRefused
+	default:
+		return ErrorClassNone
+	}
+}
+
+// RetryPolicy decides if & when a failed api call is retried
+type RetryPolicy struct {
+	// Backoff between two attempts of an api call. Steps is
+	// the max number of attempts of an api call.
+	Backoff wait.Backoff
+
+	// Budget is the max number of retries a client can make
+	// across all its api calls of a test run
+	//
+	// NOTE:
+	//  Budget is reset whenever a test run that observes the
+	// client begins
+	Budget int32
+
+	// Classes are the error classes that are retried
+	Classes []ErrorClass
+}
+
+// DefaultRetryPolicy retries the transient error classes with
+// an exponential backoff
+var DefaultRetryPolicy = RetryPolicy{
+	Backoff: wait.Backoff{
+		Duration: 200 * time.Millisecond,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    5,
+	},
+	Budget: 100,
+	Classes: []ErrorClass{
+		ErrorClassThrottled,
+		ErrorClassServerTimeout,
+		ErrorClassConnectionRefused,
+	},
+}
+
+// NoRetryPolicy never retries a failed api call
+var NoRetryPolicy = RetryPolicy{
+	Backoff: wait.Backoff{Steps: 1},
+}
+
+// isRetryable returns true if errors of the provided class
+// are retried for the provided api call
+func (p RetryPolicy) isRetryable(ac apiCall, class ErrorClass) bool {
+	if class == ErrorClassNone {
+		return false
+	}
+	// resending an update having a stale resource version
+	// conflicts again; Apply re-fetches the object instead
+	if class == ErrorClassConflict && ac.verb == "update" {
+		return false
+	}
+	for _, c := range p.Classes {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// takeRetry consumes one retry from the client's retry budget.
+// It returns false if the budget is exhausted.
+func (uc *DynClient) takeRetry() bool {
+	if atomic.AddInt32(&uc.retries, 1) <= uc.retryPolicy.Budget {
+		return true
+	}
+	atomic.AddInt32(&uc.retries, -1)
+	return false
+}
+
+// Retries returns the number of retries made by this client
+// in the current test run
+func (uc *DynClient) Retries() int32 {
+	return atomic.LoadInt32(&uc.retries)
+}
+
+// ObserveRun implements RunObserver interface. The retry
+// budget is reset & latencies are reported afresh for the run
+// that begins.
+func (uc *DynClient) ObserveRun() {
+	atomic.StoreInt32(&uc.retries, 0)
+	if uc.transcript != nil {
+		uc.transcript.beginRun()
+	}
+}
+
+// withRetry invokes the provided function & retries it based
+// on the client's retry policy. Every retry is logged.
+func (uc *DynClient) withRetry(ctx context.Context, ac apiCall, fn func() error) error {
+	backoff := uc.retryPolicy.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		class := ClassifyError(err)
+		if err == nil || !uc.retryPolicy.isRetryable(ac, class) {
+			return err
+		}
+		if attempt >= uc.retryPolicy.Backoff.Steps {
+			return errors.Wrapf(err, "failed to %s after %d attempts", ac, attempt)
+		}
+		if !uc.takeRetry() {
+			return errors.Wrapf(
+				err,
+				"failed to %s: retry budget of %d exhausted",
+				ac,
+				uc.retryPolicy.Budget,
+			)
+		}
+		delay := backoff.Step()
+		fmt.Printf(
+			"retrying %s: attempt %d failed: %s: %v: next attempt in %s\n",
+			ac,
+			attempt,
+			class,
+			err,
+			delay,
+		)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return errors.Wrapf(err, "failed to %s: %v", ac, ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package kgetset
+
+import (
+	"context"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestClassifyError(t *testing.T) {
+	gr := schema.GroupResource{Group: "openebs.io", Resource: "hellos"}
+	var tests = map[string]struct {
+		err      error
+		expected ErrorClass
+	}{
+		"nil": {
+			err:      nil,
+			expected: ErrorClassNone,
+		},
+		"not found": {
+			err:      k8serrors.NewNotFound(gr, "my-hello"),
+			expected: ErrorClassNone,
+		},
+		"conflict": {
+			err:      k8serrors.NewConflict(gr, "my-hello", errors.New("modified")),
+			expected: ErrorClassConflict,
+		},
+		"wrapped conflict": {
+			err: errors.Wrapf(
+				k8serrors.NewConflict(gr, "my-hello", errors.New("modified")),
+				"failed to update",
+			),
+			expected: ErrorClassConflict,
+		},
+		"too many requests": {
+			err:      k8serrors.NewTooManyRequests("slow down", 1),
+			expected: ErrorClassThrottled,
+		},
+		"server timeout": {
+			err:      k8serrors.NewServerTimeout(gr, "get", 1),
+			expected: ErrorClassServerTimeout,
+		},
+		"gateway timeout": {
+			err:      k8serrors.NewTimeoutError("timed out", 1),
+			expected: ErrorClassServerTimeout,
+		},
+		"connection refused": {
+			err:      syscall.ECONNREFUSED,
+			expected: ErrorClassConnectionRefused,
+		},
+		"connection reset": {
+			err:      syscall.ECONNRESET,
+			expected: ErrorClassConnectionRefused,
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			got := ClassifyError(mock.err)
+			if got != mock.expected {
+				t.Fatalf("test failed: expected %q got %q", mock.expected, got)
+			}
+		})
+	}
+}
+
+func TestWithRetryHonoursBudget(t *testing.T) {
+	uc := &DynClient{
+		retryPolicy: RetryPolicy{
+			Backoff: wait.Backoff{Steps: 10},
+			Budget:  2,
+			Classes: []ErrorClass{ErrorClassThrottled},
+		},
+	}
+	var attempts int
+	err := uc.withRetry(context.Background(), apiCall{verb: "get"}, func() error {
+		attempts++
+		return k8serrors.NewTooManyRequests("slow down", 1)
+	})
+	if err == nil {
+		t.Fatalf("test failed: expected error got nil")
+	}
+	if attempts != 3 {
+		t.Fatalf("test failed: expected 3 attempts got %d", attempts)
+	}
+	if uc.Retries() != 2 {
+		t.Fatalf("test failed: expected 2 retries got %d", uc.Retries())
+	}
+}
+
+func TestWithRetrySkipsUpdateConflict(t *testing.T) {
+	uc := &DynClient{retryPolicy: DefaultRetryPolicy}
+	gr := schema.GroupResource{Group: "openebs.io", Resource: "hellos"}
+	var attempts int
+	err := uc.withRetry(context.Background(), apiCall{verb: "update"}, func() error {
+		attempts++
+		return k8serrors.NewConflict(gr, "my-hello", errors.New("modified"))
+	})
+	if !k8serrors.IsConflict(err) {
+		t.Fatalf("test failed: expected conflict got %+v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("test failed: expected 1 attempt got %d", attempts)
+	}
+}
+
+func TestDefaultRetryPolicySkipsConflict(t *testing.T) {
+	uc := &DynClient{retryPolicy: DefaultRetryPolicy}
+	gr := schema.GroupResource{Group: "openebs.io", Resource: "hellos"}
+	for _, verb := range []string{"create", "update", "patch", "delete"} {
+		var attempts int
+		err := uc.withRetry(context.Background(), apiCall{verb: verb}, func() error {
+			attempts++
+			return k8serrors.NewConflict(gr, "my-hello", errors.New("modified"))
+		})
+		if !k8serrors.IsConflict(err) || attempts != 1 {
+			t.Fatalf("test failed: %s: expected 1 conflicting attempt got %d: %v", verb, attempts, err)
+		}
+	}
+}
+
+func TestRetryBudgetIsPerRun(t *testing.T) {
+	uc := &DynClient{
+		retryPolicy: RetryPolicy{
+			Backoff: wait.Backoff{Steps: 10},
+			Budget:  2,
+			Classes: []ErrorClass{ErrorClassThrottled},
+		},
+	}
+	var attempts int
+	throttled := func() error {
+		attempts++
+		if attempts%2 == 1 {
+			return k8serrors.NewTooManyRequests("slow down", 1)
+		}
+		return nil
+	}
+	suite := &TestAbstract{
+		Observers: []StepObserver{uc},
+		Steps: []Step{
+			NewStep("get", func() error {
+				// each call is retried once
+				for i := 0; i < 2; i++ {
+					err := uc.withRetry(context.Background(), apiCall{verb: "get"}, throttled)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			}),
+		},
+	}
+	for run := 1; run <= 3; run++ {
+		err := suite.Test()
+		if err != nil {
+			t.Fatalf("test failed: run %d: %+v", run, err)
+		}
+		if uc.Retries() != 2 {
+			t.Fatalf("test failed: run %d: expected 2 retries got %d", run, uc.Retries())
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package kgetset
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// DefaultStepGracePeriod is how long a timed out step is
+// waited for to return
+const DefaultStepGracePeriod = 1 * time.Second
+
+// stepKey is the context key that holds the name of the step
+// making the api calls
+type stepKey struct{}
+
+// Step is a named step of a test
+type Step struct {
+	// Name identifies this step in logs & reports e.g. createB
+	Name string
+
+	Fn func(ctx context.Context) error
+
+	// Timeout bounds all the attempts of this step. Step does
+	// not time out if this is not set.
+	Timeout time.Duration
+
+	// GracePeriod is how long this step is waited for to return
+	// once it times out. A step that is still running after this
+	// is reported as leaked. Defaults to DefaultStepGracePeriod.
+	GracePeriod time.Duration
+
+	// Retry is the backoff between two attempts of a failed
+	// step. Retry.Steps is the max number of attempts.
+	//
+	// NOTE:
+	//  Step is attempted once if this is not set
+	Retry wait.Backoff
+
+	// ExpectError is a regular expression that the error of
+	// this step is expected to match. Step fails if it does not
+	// error.
+	ExpectError string
+
+	// Requires are the cluster features this step needs. Step
+	// is skipped if these are not met.
+	Requires Requirements
+}
+
+// NewStep returns a step with the provided name that invokes
+// the provided function
+func NewStep(name string, fn func() error) Step {
+	s := Step{Name: name}
+	if fn != nil {
+		s.Fn = func(context.Context) error {
+			return fn()
+		}
+	}
+	return s
+}
+
+// StepResult is the outcome of a step
+type StepResult struct {
+	Name     string
+	Attempts int
+	Elapsed  time.Duration
+	Err      error
+
+	// SkipReason is set if the step was not applicable to the
+	// cluster
+	SkipReason string
+
+	// Leaked is set if the step timed out & was still running
+	// after its grace period
+	Leaked bool
+}
+
+// attempt invokes this step once & matches its error against
+// the expected error if any
+//
+// NOTE:
+//  An attempt that outlives the provided context is waited for
+// till its grace period & is then abandoned since its function
+// may not honour the context. Such an attempt is reported as
+// leaked.
+func (s Step) attempt(ctx context.Context) (leaked bool, err error) {
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Fn(ctx)
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		grace := s.GracePeriod
+		if grace <= 0 {
+			grace = DefaultStepGracePeriod
+		}
+		select {
+		case <-done:
+		case <-time.After(grace):
+			leaked = true
+		}
+		return leaked, errors.Errorf("timed out after %s", s.Timeout)
+	}
+	if s.ExpectError == "" {
+		return false, err
+	}
+	if err == nil {
+		return false, errors.Errorf("expected error matching %q got none", s.ExpectError)
+	}
+	matched, merr := regexp.MatchString(s.ExpectError, err.Error())
+	if merr != nil {
+		return false, errors.Wrapf(merr, "invalid expected error %q", s.ExpectError)
+	}
+	if !matched {
+		return false, errors.Errorf("expected error matching %q got: %v", s.ExpectError, err)
+	}
+	return false, nil
+}
+
+// run attempts this step till it succeeds, runs out of its
+// attempts or times out
+//
+// NOTE:
+//  Api calls made with the context of this step are recorded
+// against this step even if it leaked
+func (s Step) run() StepResult {
+	result := StepResult{Name: s.Name}
+	start := time.Now()
+	defer func() {
+		result.Elapsed = time.Since(start)
+	}()
+
+	ctx := context.WithValue(context.Background(), stepKey{}, s.Name)
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	maxAttempts := s.Retry.Steps
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	backoff := s.Retry
+
+	var err error
+	for {
+		result.Attempts++
+		result.Leaked, err = s.attempt(ctx)
+		if result.Leaked {
+			fmt.Printf("%s is still running after its timeout\n", s.Name)
+		}
+		if err == nil || result.Attempts >= maxAttempts || ctx.Err() != nil {
+			break
+		}
+		fmt.Printf("%s attempt %d failed: %v\n", s.Name, result.Attempts, err)
+		select {
+		case <-time.After(backoff.Step()):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			fmt.Printf("%s timed out after %s\n", s.Name, s.Timeout)
+			break
+		}
+	}
+	if err == nil {
+		return result
+	}
+	if result.Attempts == 1 {
+		result.Err = errors.Wrapf(err, "%s failed", s.Name)
+	} else {
+		result.Err = errors.Wrapf(
+			err,
+			"%s failed after %d attempts",
+			s.Name,
+			result.Attempts,
+		)
+	}
+	return result
+}
@@ -0,0 +1,204 @@
+package kgetset
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestStepRun(t *testing.T) {
+	var tests = map[string]struct {
+		step     Step
+		failures int
+		err      string
+		attempts int
+	}{
+		"passes": {
+			step:     Step{Name: "createA"},
+			attempts: 1,
+		},
+		"fails": {
+			step:     Step{Name: "createA"},
+			failures: 1,
+			err:      "createA failed: conflict",
+			attempts: 1,
+		},
+		"passes on retry": {
+			step:     Step{Name: "createA", Retry: wait.Backoff{Steps: 3}},
+			failures: 2,
+			attempts: 3,
+		},
+		"fails after retries": {
+			step:     Step{Name: "createB", Retry: wait.Backoff{Steps: 3}},
+			failures: 5,
+			err:      "createB failed after 3 attempts: conflict",
+			attempts: 3,
+		},
+		"expected error": {
+			step:     Step{Name: "createB", ExpectError: "^conf"},
+			failures: 1,
+			attempts: 1,
+		},
+		"expected error is not returned": {
+			step:     Step{Name: "createB", ExpectError: "^conf"},
+			err:      `createB failed: expected error matching "^conf" got none`,
+			attempts: 1,
+		},
+		"times out": {
+			step: Step{
+				Name:    "createB",
+				Timeout: 10 * time.Millisecond,
+				Retry:   wait.Backoff{Duration: time.Hour, Steps: 3},
+			},
+			failures: 5,
+			err:      "createB failed: conflict",
+			attempts: 1,
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			var calls int
+			mock.step.Fn = func(context.Context) error {
+				calls++
+				if calls <= mock.failures {
+					return errors.New("conflict")
+				}
+				return nil
+			}
+			suite := &TestAbstract{Steps: []Step{mock.step}}
+			err := suite.Test()
+			if mock.err == "" && err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+			if mock.err != "" && (err == nil || err.Error() != mock.err) {
+				t.Fatalf("test failed: expected error %q got %v", mock.err, err)
+			}
+			steps := suite.Result().Steps
+			if len(steps) != 1 || steps[0].Attempts != mock.attempts {
+				t.Fatalf("test failed: expected %d attempts got %+v", mock.attempts, steps)
+			}
+		})
+	}
+}
+
+func TestStepTimeoutInterruptsBlockedFn(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+	suite := &TestAbstract{
+		Steps: []Step{
+			{
+				Name:        "createB",
+				Timeout:     20 * time.Millisecond,
+				GracePeriod: 10 * time.Millisecond,
+				Retry:       wait.Backoff{Steps: 3},
+				// ignores its context
+				Fn: func(context.Context) error {
+					<-unblock
+					return nil
+				},
+			},
+		},
+	}
+	start := time.Now()
+	err := suite.Test()
+	if err == nil || err.Error() != "createB failed: timed out after 20ms" {
+		t.Fatalf("test failed: expected time out got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("test failed: expected step to be interrupted got %s", elapsed)
+	}
+	steps := suite.Result().Steps
+	if len(steps) != 1 || steps[0].Attempts != 1 {
+		t.Fatalf("test failed: expected 1 attempt got %+v", steps)
+	}
+	if !steps[0].Leaked {
+		t.Fatalf("test failed: expected leaked step got %+v", steps[0])
+	}
+}
+
+func TestStepReturningWithinGracePeriodIsNotLeaked(t *testing.T) {
+	s := Step{
+		Name:        "createB",
+		Timeout:     20 * time.Millisecond,
+		GracePeriod: time.Second,
+		Fn: func(ctx context.Context) error {
+			<-ctx.Done()
+			// cleans up before returning
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		},
+	}
+	result := s.run()
+	if result.Err == nil || result.Leaked {
+		t.Fatalf("test failed: expected time out without leak got %+v", result)
+	}
+}
+
+func TestLeakedStepDoesNotInterleaveTeardown(t *testing.T) {
+	client := NewFakeDynClientOrDie()
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	suite := &TestAbstract{
+		Observers: []StepObserver{client},
+		Steps: []Step{
+			{
+				Name:        "when",
+				Timeout:     20 * time.Millisecond,
+				GracePeriod: 10 * time.Millisecond,
+				// keeps calling K8s after its timeout
+				Fn: func(ctx context.Context) error {
+					defer close(stopped)
+					for {
+						select {
+						case <-stop:
+							return nil
+						default:
+						}
+						_, _ = client.Get(ctx, namespaceGVK, "", "leaked")
+						time.Sleep(time.Millisecond)
+					}
+				},
+			},
+		},
+		Teardownfn: func() error {
+			for i := 0; i < 3; i++ {
+				_, _ = client.Get(context.Background(), namespaceGVK, "", "torn-down")
+				time.Sleep(10 * time.Millisecond)
+			}
+			return nil
+		},
+	}
+	err := suite.Test()
+	close(stop)
+	<-stopped
+	if err == nil || err.Error() != "when failed: timed out after 20ms" {
+		t.Fatalf("test failed: expected time out got %v", err)
+	}
+	steps := suite.Result().Steps
+	if len(steps) != 2 || !steps[0].Leaked {
+		t.Fatalf("test failed: expected leaked step & teardown got %+v", steps)
+	}
+
+	var inTeardown, leakedInTeardown bool
+	for _, e := range client.Transcript().Entries() {
+		if e.Name == "torn-down" {
+			inTeardown = true
+		}
+		if e.Name == "leaked" && e.Step != "when" {
+			t.Fatalf("test failed: expected leaked call of step %q got %q", "when", e.Step)
+		}
+		if e.Name == "leaked" && inTeardown {
+			leakedInTeardown = true
+		}
+		if e.Step == "teardown" && e.Name != "torn-down" {
+			t.Fatalf("test failed: expected teardown calls only got %s %s", e.Verb, e.Name)
+		}
+	}
+	if !leakedInTeardown {
+		t.Fatalf("test failed: expected leaked step to run along with teardown")
+	}
+}
@@ -0,0 +1,178 @@
+package kgetset
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// StatusSubresource is the subresource to read & write the
+	// status of an object
+	StatusSubresource = "status"
+
+	// ScaleSubresource is the subresource to read & write the
+	// replicas of an object
+	ScaleSubresource = "scale"
+)
+
+// HasSubresource returns true if K8s serves the provided
+// subresource of the provided kind
+func (uc *DynClient) HasSubresource(gvk schema.GroupVersionKind, subresource string) (bool, error) {
+	mapping, err := uc.RESTMapping(gvk)
+	if err != nil {
+		return false, err
+	}
+	return uc.hasSubresource(mapping.Resource, subresource)
+}
+
+func (uc *DynClient) hasSubresource(gvr schema.GroupVersionResource, subresource string) (bool, error) {
+	list, err := uc.discovery.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to discover subresources of %s", gvr)
+	}
+	for _, res := range list.APIResources {
+		if res.Name == gvr.Resource+"/"+subresource {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkSubresource returns an error if K8s does not serve the
+// provided subresource of the provided resource
+//
+// NOTE:
+//  Cached discovery is dropped once before giving up since
+// the CRD might have enabled the subresource recently
+func (uc *DynClient) checkSubresource(gvr schema.GroupVersionResource, subresource string) error {
+	found, err := uc.hasSubresource(gvr, subresource)
+	if err != nil || found {
+		return err
+	}
+	uc.mapper.Reset()
+	found, err = uc.hasSubresource(gvr, subresource)
+	if err != nil || found {
+		return err
+	}
+	return errors.Errorf(
+		"%s subresource is not enabled for %s: check subresources of its crd",
+		subresource,
+		gvr,
+	)
+}
+
+// GetStatus fetches the object with the provided name via its
+// status subresource
+func (uc *DynClient) GetStatus(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+) (*unstructured.Unstructured, error) {
+	return uc.getSubresource(ctx, gvk, namespace, name, StatusSubresource)
+}
+
+// UpdateStatus updates the status of the provided object via
+// its status subresource
+//
+// NOTE:
+//  K8s ignores changes to anything other than status
+func (uc *DynClient) UpdateStatus(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	obj *unstructured.Unstructured,
+) (*unstructured.Unstructured, error) {
+	return uc.updateSubresource(ctx, gvk, namespace, obj, StatusSubresource)
+}
+
+// GetScale fetches the autoscaling/v1 Scale of the object with
+// the provided name
+func (uc *DynClient) GetScale(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+) (*unstructured.Unstructured, error) {
+	return uc.getSubresource(ctx, gvk, namespace, name, ScaleSubresource)
+}
+
+// UpdateScale sets the desired replicas of the object with the
+// provided name via its scale subresource. The updated Scale
+// is returned.
+func (uc *DynClient) UpdateScale(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	replicas int64,
+) (*unstructured.Unstructured, error) {
+	scale, err := uc.GetScale(ctx, gvk, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	err = unstructured.SetNestedField(scale.Object, replicas, "spec", "replicas")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to update scale of %q", name)
+	}
+	return uc.updateSubresource(ctx, gvk, namespace, scale, ScaleSubresource)
+}
+
+func (uc *DynClient) getSubresource(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	subresource string,
+) (*unstructured.Unstructured, error) {
+	ac := apiCall{
+		verb:        "get",
+		gvk:         gvk,
+		namespace:   namespace,
+		name:        name,
+		subresource: subresource,
+	}
+	got, err := uc.call(ctx, ac, func(ri dynamic.ResourceInterface) (runtime.Object, error) {
+		return ri.Get(name, metav1.GetOptions{}, subresource)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return got.(*unstructured.Unstructured), nil
+}
+
+func (uc *DynClient) updateSubresource(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	obj *unstructured.Unstructured,
+	subresource string,
+) (*unstructured.Unstructured, error) {
+	body, err := toJSONUnstructured(obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to update %s of %q", subresource, obj.GetName())
+	}
+	ac := apiCall{
+		verb:        "update",
+		gvk:         gvk,
+		namespace:   namespace,
+		name:        obj.GetName(),
+		subresource: subresource,
+		request:     body,
+		dryRun:      uc.IsDryRun(ctx),
+	}
+	options := metav1.UpdateOptions{DryRun: uc.dryRunOption(ctx)}
+	got, err := uc.call(ctx, ac, func(ri dynamic.ResourceInterface) (runtime.Object, error) {
+		return ri.Update(body, options, subresource)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return got.(*unstructured.Unstructured), nil
+}
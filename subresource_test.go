@@ -0,0 +1,157 @@
+package kgetset
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+// TestSubresourceCalls verifies how DynClient routes its calls
+// to subresources & records them
+//
+// NOTE:
+//  Isolation of spec & status by the subresources is done by
+// K8s & hence this needs a real cluster to be verified
+func TestSubresourceCalls(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	var scaleBody *unstructured.Unstructured
+	subresource := func(get map[string]interface{}) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			call := r.Method + " " + strings.TrimPrefix(r.URL.Path, "/apis/openebs.io/v1/namespaces/default/")
+			if dryRun := r.URL.Query().Get("dryRun"); dryRun != "" {
+				call += " dryRun=" + dryRun
+			}
+			calls = append(calls, call)
+			if r.Method == http.MethodGet {
+				writeJSON(w, get)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			if strings.HasSuffix(r.URL.Path, "/scale") {
+				scaleBody = &unstructured.Unstructured{}
+				_ = scaleBody.UnmarshalJSON(body)
+			}
+			// updated object is returned as is
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(body)
+		}
+	}
+	server := newTestServer(map[string]http.HandlerFunc{
+		"/apis/openebs.io/v1/namespaces/default/hellos/my-hello/status": subresource(
+			map[string]interface{}{
+				"apiVersion": "openebs.io/v1",
+				"kind":       "Hello",
+				"metadata":   map[string]interface{}{"name": "my-hello", "namespace": "default"},
+				"spec":       map[string]interface{}{"replicas": 1},
+			},
+		),
+		"/apis/openebs.io/v1/namespaces/default/hellos/my-hello/scale": subresource(
+			map[string]interface{}{
+				"apiVersion": "autoscaling/v1",
+				"kind":       "Scale",
+				"metadata":   map[string]interface{}{"name": "my-hello", "namespace": "default"},
+				"spec":       map[string]interface{}{"replicas": 1},
+			},
+		),
+		"/apis/openebs.io/v1/namespaces/default/byes/": subresource(nil),
+	})
+	defer server.Close()
+
+	client, err := NewDynClientForConfig(
+		&rest.Config{Host: server.URL},
+		WithRetryPolicy(NoRetryPolicy),
+	)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	ctx := context.Background()
+	gvk := schema.GroupVersionKind{Group: "openebs.io", Version: "v1", Kind: "Hello"}
+
+	got, err := client.GetStatus(ctx, gvk, "default", "my-hello")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	got.Object["status"] = map[string]interface{}{"phase": "Up"}
+	_, err = client.UpdateStatus(ctx, gvk, "default", got)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	_, err = client.UpdateScale(ctx, gvk, "default", "my-hello", 3)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	_, err = client.UpdateStatus(DryRunContext(ctx), gvk, "default", got)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+
+	// byes do not enable any subresource
+	byeGVK := gvk.GroupVersion().WithKind("Bye")
+	_, err = client.GetScale(ctx, byeGVK, "default", "my-bye")
+	if err == nil || !strings.Contains(err.Error(), "scale subresource is not enabled") {
+		t.Fatalf("test failed: expected scale not enabled error got %v", err)
+	}
+	_, err = client.UpdateStatus(ctx, byeGVK, "default", got)
+	if err == nil || !strings.Contains(err.Error(), "status subresource is not enabled") {
+		t.Fatalf("test failed: expected status not enabled error got %v", err)
+	}
+
+	// calls reach K8s via their subresource & the ones to a
+	// subresource that is not enabled are never sent
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{
+		"GET hellos/my-hello/status",
+		"PUT hellos/my-hello/status",
+		"GET hellos/my-hello/scale",
+		"PUT hellos/my-hello/scale",
+		"PUT hellos/my-hello/status dryRun=All",
+	}
+	if strings.Join(calls, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("test failed: expected calls %v got %v", expected, calls)
+	}
+	if scaleBody == nil || scaleBody.GetKind() != "Scale" {
+		t.Fatalf("test failed: expected scale body got %v", scaleBody)
+	}
+	replicas, _, _ := unstructured.NestedInt64(scaleBody.Object, "spec", "replicas")
+	if replicas != 3 {
+		t.Fatalf("test failed: expected spec replicas 3 got %d", replicas)
+	}
+
+	var recorded []string
+	for _, e := range client.Transcript().Entries() {
+		if e.Subresource == "" {
+			continue
+		}
+		entry := e.Verb + " " + e.Name + "/" + e.Subresource
+		if e.DryRun {
+			entry += " (dry run)"
+		}
+		if e.Error != "" {
+			entry += " (failed)"
+		}
+		recorded = append(recorded, entry)
+	}
+	expected = []string{
+		"get my-hello/status",
+		"update my-hello/status",
+		"get my-hello/scale",
+		"update my-hello/scale",
+		"update my-hello/status (dry run)",
+		"get my-bye/scale (failed)",
+		"update my-hello/status (failed)",
+	}
+	if strings.Join(recorded, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("test failed: expected transcript %v got %v", expected, recorded)
+	}
+}
@@ -2,7 +2,10 @@ package kgetset
 
 import (
 	"fmt"
+	"strings"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 type Testsuite interface {
@@ -15,6 +18,19 @@ type BDD interface {
 	Then() error
 }
 
+// StepObserver gets notified whenever a test step begins
+type StepObserver interface {
+	ObserveStep(step string)
+}
+
+// RunObserver gets notified whenever a test run begins
+//
+// NOTE:
+//  DynClient is a run observer & resets its retry budget
+type RunObserver interface {
+	ObserveRun()
+}
+
 type TestFns []func() error
 
 func (f TestFns) Run() error {
@@ -30,6 +46,25 @@ func (f TestFns) Run() error {
 	return nil
 }
 
+// RunAll runs all the functions even if some of them fail.
+// It returns an error listing all the failures if any.
+func (f TestFns) RunAll() error {
+	var msgs []string
+	for _, fn := range f {
+		if fn == nil {
+			continue
+		}
+		err := fn()
+		if err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.Errorf("%d of %d failed: %s", len(msgs), len(f), strings.Join(msgs, ": "))
+}
+
 const (
 	StepSetup = iota + 1
 	StepPostSetup
@@ -46,10 +81,18 @@ const (
 // of the common features required by instances
 // implementing bdd or testsuite interface
 type TestAbstract struct {
+	// WaitPostSteps are the step numbers after which the
+	// test waits for WaitTime
+	//
+	// NOTE:
+	//  Prefer WaitFor with a condition over a fixed wait
 	WaitPostSteps []int
 	WaitTime      time.Duration
 
-	Steps   []func() error
+	// Steps are run in their order. Setup, Given, When, Then &
+	// Teardown phases are run as named steps if these are not
+	// set.
+	Steps   []Step
 	stepIdx int
 
 	Setupfn     func() error
@@ -61,14 +104,156 @@ type TestAbstract struct {
 	Givenfn func() error
 	Whenfn  func() error
 	Thenfn  func() error
+
+	// Observers are notified of every step that gets executed
+	//
+	// NOTE:
+	//  DynClient is an observer & records its api calls
+	// against the notified step
+	Observers []StepObserver
+
+	// Requires are the cluster features this test needs. Test
+	// is skipped if these are not met.
+	//
+	// NOTE:
+	//  These are checked by the first observer that is a
+	// RequirementsChecker e.g. DynClient
+	Requires Requirements
+
+	// result of the last test run
+	result TestResult
+
+	// steps are the outcomes of the steps of the current run
+	steps []StepResult
+}
+
+// TestResult is the outcome of a test run
+type TestResult struct {
+	Err     error
+	Elapsed time.Duration
+
+	// Latencies of the api calls made during the run
+	//
+	// NOTE:
+	//  These are reported by the first observer that is a
+	// LatencyReporter e.g. DynClient
+	Latencies LatencyReport
+
+	// Skipped is true if the test was not applicable to the
+	// cluster due to SkipReason
+	Skipped    bool
+	SkipReason string
+
+	// Steps are the outcomes of the steps that were run
+	Steps []StepResult
+}
+
+// Result returns the outcome of the last test run
+func (t *TestAbstract) Result() TestResult {
+	return t.result
+}
+
+// finish sets the outcome of the test run that started at the
+// provided time. Test was skipped if the provided reason is
+// set.
+func (t *TestAbstract) finish(start time.Time, err error, skipReason string) {
+	t.result = TestResult{
+		Err:        err,
+		Elapsed:    time.Since(start),
+		Skipped:    skipReason != "",
+		SkipReason: skipReason,
+		Steps:      t.steps,
+	}
+	for _, o := range t.Observers {
+		if r, ok := o.(LatencyReporter); ok {
+			t.result.Latencies = r.LatencyReport()
+			return
+		}
+	}
+}
+
+// skipReason returns the reason why the provided requirements
+// are not met. Reason is empty if the test or step should run.
+func (t *TestAbstract) skipReason(r Requirements) (string, error) {
+	if r.IsEmpty() {
+		return "", nil
+	}
+	for _, o := range t.Observers {
+		if c, ok := o.(RequirementsChecker); ok {
+			return c.CheckRequirements(r)
+		}
+	}
+	return "", errors.Errorf(
+		"failed to check requirements %+v: no observer is a requirements checker",
+		r,
+	)
+}
+
+// beginStep logs the provided step & notifies the observers
+func (t *TestAbstract) beginStep(name string) {
+	fmt.Printf("executing %s\n", name)
+	t.notify(name)
+}
+
+// phaseSteps returns the phases of this test as named steps
+//
+// NOTE:
+//  Phases that are not set are steps without a function. These
+// are counted by WaitPostSteps but are not run.
+func (t *TestAbstract) phaseSteps() []Step {
+	return []Step{
+		NewStep("setup", t.Setupfn),
+		NewStep("postsetup", t.PostSetupfn),
+		NewStep("given", t.Givenfn),
+		NewStep("when", t.Whenfn),
+		NewStep("then", t.Thenfn),
+		NewStep("teardown", t.Teardownfn),
+		NewStep("postteardown", t.PostTeardownfn),
+	}
+}
+
+// runStep runs the provided step if it applies & records its
+// outcome
+func (t *TestAbstract) runStep(s Step) StepResult {
+	t.stepIdx++
+	if s.Fn == nil {
+		return StepResult{Name: s.Name}
+	}
+	var result StepResult
+	defer func() {
+		t.steps = append(t.steps, result)
+	}()
+	reason, err := t.skipReason(s.Requires)
+	if err != nil {
+		result = StepResult{Name: s.Name, Err: errors.Wrapf(err, "%s failed", s.Name)}
+		return result
+	}
+	if reason != "" {
+		fmt.Printf("skipping %s: %s\n", s.Name, reason)
+		result = StepResult{Name: s.Name, SkipReason: reason}
+		return result
+	}
+	t.beginStep(s.Name)
+	result = s.run()
+	return result
+}
+
+// notify passes the provided step to all the observers
+func (t *TestAbstract) notify(step string) {
+	for _, o := range t.Observers {
+		if o == nil {
+			continue
+		}
+		o.ObserveStep(step)
+	}
 }
 
 func (t *TestAbstract) waitPostStep() {
 	if len(t.WaitPostSteps) == 0 {
 		return
 	}
-	for idx := range t.WaitPostSteps {
-		if idx == t.stepIdx {
+	for _, step := range t.WaitPostSteps {
+		if step == t.stepIdx {
 			time.Sleep(t.WaitTime)
 		}
 	}
@@ -78,7 +263,7 @@ func (t *TestAbstract) Setup() error {
 	if t.Setupfn == nil {
 		return nil
 	}
-	fmt.Printf("[%d] executing setup\n", t.stepIdx)
+	t.beginStep("setup")
 	return t.Setupfn()
 }
 
@@ -86,7 +271,7 @@ func (t *TestAbstract) PostSetup() error {
 	if t.PostSetupfn == nil {
 		return nil
 	}
-	fmt.Printf("[%d] executing postsetup\n", t.stepIdx)
+	t.beginStep("postsetup")
 	return t.PostSetupfn()
 }
 
@@ -94,7 +279,7 @@ func (t *TestAbstract) Teardown() error {
 	if t.Teardownfn == nil {
 		return nil
 	}
-	fmt.Printf("[%d] executing teardown\n", t.stepIdx)
+	t.beginStep("teardown")
 	return t.Teardownfn()
 }
 
@@ -102,7 +287,7 @@ func (t *TestAbstract) PostTeardown() error {
 	if t.PostTeardownfn == nil {
 		return nil
 	}
-	fmt.Printf("[%d] executing postteardown\n", t.stepIdx)
+	t.beginStep("postteardown")
 	return t.PostTeardownfn()
 }
 
@@ -110,7 +295,7 @@ func (t *TestAbstract) Given() error {
 	if t.Givenfn == nil {
 		return nil
 	}
-	fmt.Printf("[%d] executing given\n", t.stepIdx)
+	t.beginStep("given")
 	return t.Givenfn()
 }
 
@@ -118,7 +303,7 @@ func (t *TestAbstract) When() error {
 	if t.Whenfn == nil {
 		return nil
 	}
-	fmt.Printf("[%d] executing when\n", t.stepIdx)
+	t.beginStep("when")
 	return t.Whenfn()
 }
 
@@ -126,35 +311,51 @@ func (t *TestAbstract) Then() error {
 	if t.Thenfn == nil {
 		return nil
 	}
-	fmt.Printf("[%d] executing then\n", t.stepIdx)
+	t.beginStep("then")
 	return t.Thenfn()
 }
 
-func (t *TestAbstract) Test() error {
+func (t *TestAbstract) Test() (err error) {
+	start := time.Now()
+	var reason string
+	defer func() {
+		t.finish(start, err, reason)
+	}()
+
+	t.steps = nil
+	t.stepIdx = 0
+	for _, o := range t.Observers {
+		if r, ok := o.(RunObserver); ok {
+			r.ObserveRun()
+		}
+	}
+	reason, err = t.skipReason(t.Requires)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		fmt.Printf("skipping test: %s\n", reason)
+		return nil
+	}
+
 	var steps = t.Steps
 
 	if len(steps) == 0 {
-		steps = []func() error{
-			t.Setup,
-			t.PostSetup,
-			t.Given,
-			t.When,
-			t.Then,
-			t.Teardown,
-			t.PostTeardown,
-		}
+		steps = t.phaseSteps()
 	}
 
-	for _, fn := range steps {
-		t.stepIdx++
-		err := fn()
-		if err != nil {
+	for _, s := range steps {
+		result := t.runStep(s)
+		if result.Err != nil {
+			// teardown is not attempted again if it is what failed
+			if s.Name == "teardown" || s.Name == "postteardown" {
+				return result.Err
+			}
 			// if error try teardown before aborting
-			t.stepIdx++
-			e := t.Teardown()
-			fmt.Printf("testsuite teardown was attempted: %+v", e)
+			teardown := t.runStep(NewStep("teardown", t.Teardownfn))
+			fmt.Printf("testsuite teardown was attempted: %+v\n", teardown.Err)
 
-			return err
+			return result.Err
 		}
 		t.waitPostStep()
 	}
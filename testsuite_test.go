@@ -0,0 +1,81 @@
+package kgetset
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestRunAllRunsEveryFn(t *testing.T) {
+	var ran []string
+	fn := func(name string, err error) func() error {
+		return func() error {
+			ran = append(ran, name)
+			return err
+		}
+	}
+	fns := TestFns{
+		fn("deleteCRD", errors.New("crd deletion is stuck")),
+		nil,
+		fn("deleteNamespace", nil),
+		fn("verify", errors.New("objects left")),
+	}
+	err := fns.RunAll()
+	if strings.Join(ran, " ") != "deleteCRD deleteNamespace verify" {
+		t.Fatalf("test failed: expected every fn to run got %v", ran)
+	}
+	if err == nil ||
+		!strings.Contains(err.Error(), "crd deletion is stuck") ||
+		!strings.Contains(err.Error(), "objects left") {
+		t.Fatalf("test failed: expected both errors got %v", err)
+	}
+}
+
+func TestFailedPhaseTearsDownOnce(t *testing.T) {
+	var tests = map[string]struct {
+		failing  string
+		expected string
+	}{
+		"when fails": {
+			failing:  "when",
+			expected: "given when teardown",
+		},
+		"teardown fails": {
+			failing:  "teardown",
+			expected: "given when teardown",
+		},
+		"postteardown fails": {
+			failing:  "postteardown",
+			expected: "given when teardown postteardown",
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			var ran []string
+			fn := func(phase string) func() error {
+				return func() error {
+					ran = append(ran, phase)
+					if phase == mock.failing {
+						return errors.New("failed")
+					}
+					return nil
+				}
+			}
+			suite := &TestAbstract{
+				Givenfn:        fn("given"),
+				Whenfn:         fn("when"),
+				Teardownfn:     fn("teardown"),
+				PostTeardownfn: fn("postteardown"),
+			}
+			err := suite.Test()
+			if err == nil {
+				t.Fatalf("test failed: expected error got nil")
+			}
+			if strings.Join(ran, " ") != mock.expected {
+				t.Fatalf("test failed: expected %q got %q", mock.expected, strings.Join(ran, " "))
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package kgetset
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// TranscriptEntry is the record of a single api call
+type TranscriptEntry struct {
+	// Step is the test step that made this api call
+	Step string `json:"step,omitempty"`
+
+	// User is the identity impersonated by this api call
+	User string `json:"user,omitempty"`
+
+	Verb string `json:"verb"`
+
+	// GVR is empty if the kind could not be mapped
+	GVR       string `json:"gvr"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+
+	// Subresource is set if the api call was made to one
+	Subresource string `json:"subresource,omitempty"`
+
+	// DryRun is set if the api call was not persisted by K8s
+	DryRun bool `json:"dryRun,omitempty"`
+
+	Request  runtime.Object `json:"request,omitempty"`
+	Response runtime.Object `json:"response,omitempty"`
+
+	// Status is set if K8s returned a status error
+	Status *metav1.Status `json:"status,omitempty"`
+
+	// Error is set if the api call failed
+	Error string `json:"error,omitempty"`
+
+	StartTime time.Time `json:"startTime"`
+
+	// Latency of the api call includes the backoff between its
+	// attempts
+	Latency time.Duration `json:"latency"`
+
+	// AttemptLatencies are the latencies of each attempt made
+	// to K8s. These exclude the backoff between the attempts.
+	AttemptLatencies []time.Duration `json:"attemptLatencies,omitempty"`
+}
+
+// Transcript records all the api calls made by a client
+//
+// NOTE:
+//  Clients derived from a client e.g. impersonating ones
+// share its transcript
+type Transcript struct {
+	mu      sync.Mutex
+	entries []TranscriptEntry
+
+	// step is the test step being executed
+	step string
+
+	// runStart is the index of the first entry recorded in the
+	// current test run
+	runStart int
+}
+
+// add appends the provided entry to this transcript
+func (t *Transcript) add(entry TranscriptEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = append(t.entries, entry)
+}
+
+// Entries returns the recorded entries in the order of their
+// api calls
+func (t *Transcript) Entries() []TranscriptEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]TranscriptEntry(nil), t.entries...)
+}
+
+// beginRun marks the entries recorded from here on as the
+// ones of a new test run
+func (t *Transcript) beginRun() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.runStart = len(t.entries)
+}
+
+// runEntries returns the entries recorded in the current test
+// run
+func (t *Transcript) runEntries() []TranscriptEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]TranscriptEntry(nil), t.entries[t.runStart:]...)
+}
+
+// WriteJSONLines writes each recorded entry as a json line
+func (t *Transcript) WriteJSONLines(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, e := range t.Entries() {
+		err := enc.Encode(e)
+		if err != nil {
+			return errors.Wrapf(
+				err,
+				"failed to write transcript: %s %s %s",
+				e.Verb,
+				e.GVR,
+				e.Name,
+			)
+		}
+	}
+	return nil
+}
+
+// ObserveStep implements StepObserver interface. Api calls
+// made from here on are recorded against the provided step.
+func (uc *DynClient) ObserveStep(step string) {
+	if uc.transcript == nil {
+		return
+	}
+	uc.transcript.mu.Lock()
+	defer uc.transcript.mu.Unlock()
+	uc.transcript.step = step
+}
+
+// currentStep returns the test step being executed
+func (t *Transcript) currentStep() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.step
+}
+
+// Transcript returns the api calls recorded by this client
+func (uc *DynClient) Transcript() *Transcript {
+	return uc.transcript
+}
+
+// record adds the provided api call to the client's transcript
+func (uc *DynClient) record(ac apiCall, res callResult, latency time.Duration) {
+	if uc.transcript == nil {
+		return
+	}
+	// a step that leaked after its timeout is not the current
+	// step & is hence known only from the call's context
+	step := ac.step
+	if step == "" {
+		step = uc.transcript.currentStep()
+	}
+	entry := TranscriptEntry{
+		Step:        step,
+		User:        uc.identity,
+		Verb:        ac.verb,
+		Namespace:   ac.namespace,
+		Name:        ac.name,
+		Subresource: ac.subresource,
+		DryRun:      ac.dryRun,
+		Request:     ac.request,
+		StartTime:   time.Now().Add(-latency),
+		Latency:     latency,
+
+		AttemptLatencies: res.attempts,
+	}
+	if !ac.gvr.Empty() {
+		entry.GVR = ac.gvr.String()
+	}
+	if res.err == nil {
+		entry.Response = res.obj
+	} else {
+		entry.Error = res.err.Error()
+		if status, ok := errors.Cause(res.err).(k8serrors.APIStatus); ok {
+			s := status.Status()
+			entry.Status = &s
+		}
+	}
+	uc.transcript.add(entry)
+}
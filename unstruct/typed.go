@@ -0,0 +1,257 @@
+package unstruct
+
+import (
+	stdjson "encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/json"
+)
+
+// IssueType is the type of a field that did not survive the
+// conversion to a typed object
+type IssueType string
+
+const (
+	// IssueDropped is a field not known to the typed object
+	IssueDropped IssueType = "dropped"
+
+	// IssueMistyped is a field whose json type differs from
+	// the one of the typed object e.g. number vs. string
+	IssueMistyped IssueType = "mistyped"
+
+	// IssueChanged is a field whose value got changed by the
+	// conversion e.g. a float stored in an int
+	IssueChanged IssueType = "changed"
+)
+
+// FieldIssue is a field that did not survive the conversion
+// to a typed object
+type FieldIssue struct {
+	Type IssueType
+	Path string
+
+	// Given is the value of the unstructured object
+	Given interface{}
+
+	// Got is the value after the conversion. It is nil for a
+	// dropped field.
+	Got interface{}
+}
+
+// String implements Stringer interface
+func (i FieldIssue) String() string {
+	if i.Type == IssueDropped {
+		return fmt.Sprintf("%s %s: %v", i.Type, i.Path, i.Given)
+	}
+	return fmt.Sprintf(
+		"%s %s: given %v (%T) got %v (%T)",
+		i.Type,
+		i.Path,
+		i.Given,
+		i.Given,
+		i.Got,
+		i.Got,
+	)
+}
+
+// ConversionError lists the fields that did not survive the
+// conversion to a typed object
+type ConversionError struct {
+	Name   string
+	Issues []FieldIssue
+}
+
+// Error implements error interface
+func (e *ConversionError) Error() string {
+	var issues []string
+	for _, i := range e.Issues {
+		issues = append(issues, i.String())
+	}
+	return fmt.Sprintf(
+		"failed to convert %q: %d field issues: %s",
+		e.Name,
+		len(e.Issues),
+		strings.Join(issues, ": "),
+	)
+}
+
+// ToTyped decodes the provided unstructured object into the
+// provided typed object i.e. a pointer to a struct
+//
+// NOTE:
+//  Conversion is strict. A *ConversionError is returned if
+// any field is dropped, mistyped or changed. Typed object is
+// decoded on a best effort basis even then.
+func ToTyped(obj *unstructured.Unstructured, into interface{}) error {
+	issues, err := RoundTripIssues(obj, into)
+	if err != nil {
+		return err
+	}
+	if len(issues) != 0 {
+		return &ConversionError{Name: obj.GetName(), Issues: issues}
+	}
+	return nil
+}
+
+// FromTyped encodes the provided typed object into an
+// unstructured object
+func FromTyped(typed interface{}) (*unstructured.Unstructured, error) {
+	raw, err := json.Marshal(typed)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to convert %T to unstructured", typed)
+	}
+	var obj map[string]interface{}
+	err = json.Unmarshal(raw, &obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to convert %T to unstructured", typed)
+	}
+	return &unstructured.Unstructured{Object: obj}, nil
+}
+
+// RoundTripIssues decodes the provided unstructured object
+// into the provided typed object & encodes it back. Fields of
+// the unstructured object that do not survive this round trip
+// are returned.
+//
+// NOTE:
+//  Fields added by the typed object e.g. zero values of
+// fields without omitempty are not considered as issues
+func RoundTripIssues(obj *unstructured.Unstructured, into interface{}) ([]FieldIssue, error) {
+	if reflect.ValueOf(into).Kind() != reflect.Ptr {
+		return nil, errors.Errorf(
+			"failed to convert %q: expected pointer got %T",
+			obj.GetName(),
+			into,
+		)
+	}
+	given, err := toJSONValue(obj.UnstructuredContent())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to convert %q", obj.GetName())
+	}
+	raw, err := json.Marshal(given)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to convert %q", obj.GetName())
+	}
+	// mistyped fields are left as zero values & are reported
+	// by the round trip
+	err = stdjson.Unmarshal(raw, into)
+	if _, ok := err.(*stdjson.UnmarshalTypeError); err != nil && !ok {
+		return nil, errors.Wrapf(err, "failed to convert %q to %T", obj.GetName(), into)
+	}
+	got, err := FromTyped(into)
+	if err != nil {
+		return nil, err
+	}
+	issues := diffJSON("", given, got.UnstructuredContent())
+	sort.Slice(issues, func(i, j int) bool {
+		return issues[i].Path < issues[j].Path
+	})
+	return issues, nil
+}
+
+// diffJSON returns the issues of the given json value that
+// differs from the got json value
+func diffJSON(path string, given, got interface{}) []FieldIssue {
+	switch g := given.(type) {
+	case map[string]interface{}:
+		gotMap, ok := got.(map[string]interface{})
+		if !ok {
+			return []FieldIssue{jsonIssue(path, given, got)}
+		}
+		var issues []FieldIssue
+		for key, val := range g {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			gotVal, found := gotMap[key]
+			if !found {
+				if isZeroJSON(val) {
+					// omitempty field
+					continue
+				}
+				issues = append(
+					issues,
+					FieldIssue{Type: IssueDropped, Path: childPath, Given: val},
+				)
+				continue
+			}
+			issues = append(issues, diffJSON(childPath, val, gotVal)...)
+		}
+		return issues
+	case []interface{}:
+		gotList, ok := got.([]interface{})
+		if !ok || len(gotList) != len(g) {
+			return []FieldIssue{jsonIssue(path, given, got)}
+		}
+		var issues []FieldIssue
+		for i := range g {
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+			issues = append(issues, diffJSON(childPath, g[i], gotList[i])...)
+		}
+		return issues
+	default:
+		if reflect.DeepEqual(given, got) {
+			return nil
+		}
+		return []FieldIssue{jsonIssue(path, given, got)}
+	}
+}
+
+// jsonIssue returns the issue of the provided differing json
+// values
+func jsonIssue(path string, given, got interface{}) FieldIssue {
+	issueType := IssueChanged
+	if jsonType(given) != jsonType(got) {
+		issueType = IssueMistyped
+	}
+	return FieldIssue{Type: issueType, Path: path, Given: given, Got: got}
+}
+
+// jsonType returns the json type of the provided value
+func jsonType(val interface{}) string {
+	switch val.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case int64, float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", val)
+	}
+}
+
+// isZeroJSON returns true if the provided json value is the
+// zero value of its type
+func isZeroJSON(val interface{}) bool {
+	switch v := val.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case int64:
+		return v == 0
+	case float64:
+		return v == 0
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
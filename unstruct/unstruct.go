@@ -1,10 +1,12 @@
 package unstruct
 
 import (
+	"reflect"
 	"strings"
 
 	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/json"
 )
 
 func IsChangeStr(src, dest *unstructured.Unstructured, path string, others ...string) (bool, error) {
@@ -41,3 +43,64 @@ func isChangeStr(src, dest *unstructured.Unstructured, path string) (bool, error
 	}
 	return sval != dval, nil
 }
+
+// IsChange returns true if the value at any of the provided
+// paths differs between src & dest
+//
+// NOTE:
+//  Values are compared after converting them to their json
+// equivalents. Hence an int in a local fixture matches the
+// int64 fetched from K8s.
+func IsChange(src, dest *unstructured.Unstructured, path string, others ...string) (bool, error) {
+	allpaths := append([]string{path}, others...)
+	for _, p := range allpaths {
+		changed, err := isChange(src, dest, p)
+		if err != nil {
+			return false, err
+		}
+		if changed {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func isChange(src, dest *unstructured.Unstructured, path string) (bool, error) {
+	sval, _, err := unstructured.NestedFieldNoCopy(
+		src.Object,
+		strings.Split(path, ".")...,
+	)
+	if err != nil {
+		return false, err
+	}
+	dval, _, err := unstructured.NestedFieldNoCopy(
+		dest.Object,
+		strings.Split(path, ".")...,
+	)
+	if err != nil {
+		return false, err
+	}
+	sjson, err := toJSONValue(sval)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to determine ischange: path %q", path)
+	}
+	djson, err := toJSONValue(dval)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to determine ischange: path %q", path)
+	}
+	return !reflect.DeepEqual(sjson, djson), nil
+}
+
+// toJSONValue returns the json equivalent of the provided value
+func toJSONValue(val interface{}) (interface{}, error) {
+	raw, err := json.Marshal(map[string]interface{}{"v": val})
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]interface{}
+	err = json.Unmarshal(raw, &obj)
+	if err != nil {
+		return nil, err
+	}
+	return obj["v"], nil
+}
@@ -137,3 +137,111 @@ func TestIsChangeStrWithSameEverything(t *testing.T) {
 		t.Fatalf("test failed: expected no change got change")
 	}
 }
+
+func TestIsChangeWithSameGoAndJSONTypes(t *testing.T) {
+	local := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"count":  1,
+				"labels": map[string]string{"app": "testing"},
+			},
+		},
+	}
+	fetched := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"count":  int64(1),
+				"labels": map[string]interface{}{"app": "testing"},
+			},
+		},
+	}
+	changed, err := IsChange(local, fetched, "spec")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if changed {
+		t.Fatalf("test failed: expected no change got change")
+	}
+}
+
+func TestIsChangeWithDiffGroup(t *testing.T) {
+	changed, err := IsChange(testUnstructInstA, testUnstructInstC, "metadata.name", "spec")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if !changed {
+		t.Fatalf("test failed: expected change got no change")
+	}
+}
+
+type testTyped struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		Count int    `json:"count"`
+		ID    string `json:"id"`
+	} `json:"spec"`
+}
+
+func TestToTypedReportsIssues(t *testing.T) {
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind": "Onlyone",
+			"metadata": map[string]interface{}{
+				"name": "onlyone-a",
+			},
+			"spec": map[string]interface{}{
+				"count": 1,
+				"id":    123,
+				"addon": "enjoy",
+			},
+		},
+	}
+	var typed testTyped
+	err := ToTyped(obj, &typed)
+	convErr, ok := err.(*ConversionError)
+	if !ok {
+		t.Fatalf("test failed: expected conversion error got %v", err)
+	}
+	if len(convErr.Issues) != 2 {
+		t.Fatalf("test failed: expected 2 issues got %s", convErr)
+	}
+	if convErr.Issues[0].Type != IssueDropped || convErr.Issues[0].Path != "spec.addon" {
+		t.Fatalf("test failed: expected dropped spec.addon got %s", convErr.Issues[0])
+	}
+	if convErr.Issues[1].Type != IssueMistyped || convErr.Issues[1].Path != "spec.id" {
+		t.Fatalf("test failed: expected mistyped spec.id got %s", convErr.Issues[1])
+	}
+	// rest of the fields are decoded
+	if typed.Spec.Count != 1 || typed.Metadata.Name != "onlyone-a" {
+		t.Fatalf("test failed: expected decoded fields got %+v", typed)
+	}
+}
+
+func TestToTypedWithoutIssues(t *testing.T) {
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"kind":     "Onlyone",
+			"metadata": map[string]interface{}{"name": "onlyone-a"},
+			"spec":     map[string]interface{}{"count": 0, "id": "123"},
+		},
+	}
+	var typed testTyped
+	err := ToTyped(obj, &typed)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	got, err := FromTyped(&typed)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	changed, err := IsChange(obj, got, "spec", "metadata")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	if changed {
+		t.Fatalf("test failed: expected no change got %+v", got)
+	}
+}
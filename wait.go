@@ -0,0 +1,212 @@
+package kgetset
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// DefaultWaitTimeout is the time till which a condition
+	// is polled when no timeout is provided
+	DefaultWaitTimeout = 2 * time.Minute
+
+	// DefaultWaitInterval is the interval between two polls
+	// when no interval is provided
+	DefaultWaitInterval = 1 * time.Second
+)
+
+// crdGVK is the kind of CustomResourceDefinition
+//
+// NOTE:
+//  Version is left empty to use the version preferred by the
+// API server
+var crdGVK = schema.GroupVersionKind{
+	Group: "apiextensions.k8s.io",
+	Kind:  "CustomResourceDefinition",
+}
+
+// Condition returns true if the expected cluster state is
+// reached
+type Condition func(ctx context.Context) (bool, error)
+
+// WaitConfig holds the settings used to poll a condition
+type WaitConfig struct {
+	Timeout  time.Duration
+	Interval time.Duration
+}
+
+// WithWaitTimeout sets the time till which a condition is
+// polled
+func WithWaitTimeout(timeout time.Duration) func(*WaitConfig) {
+	return func(c *WaitConfig) {
+		c.Timeout = timeout
+	}
+}
+
+// WithWaitInterval sets the interval between two polls
+func WithWaitInterval(interval time.Duration) func(*WaitConfig) {
+	return func(c *WaitConfig) {
+		c.Interval = interval
+	}
+}
+
+// WaitFor polls the provided condition till it returns true,
+// returns an error or times out
+func WaitFor(
+	ctx context.Context,
+	condition Condition,
+	options ...func(*WaitConfig),
+) error {
+	wc := &WaitConfig{
+		Timeout:  DefaultWaitTimeout,
+		Interval: DefaultWaitInterval,
+	}
+	for _, o := range options {
+		o(wc)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, wc.Timeout)
+	defer cancel()
+
+	err := wait.PollImmediateUntil(
+		wc.Interval,
+		func() (bool, error) {
+			return condition(ctx)
+		},
+		ctx.Done(),
+	)
+	if err == wait.ErrWaitTimeout {
+		return errors.Errorf(
+			"failed to wait: condition not met within %s",
+			wc.Timeout,
+		)
+	}
+	return err
+}
+
+// Exists returns a condition that is met when the object is
+// found at K8s
+func (uc *DynClient) Exists(
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+) Condition {
+	return func(ctx context.Context) (bool, error) {
+		_, err := uc.Get(ctx, gvk, namespace, name)
+		if k8serrors.IsNotFound(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+}
+
+// Deleted returns a condition that is met when the object is
+// no longer found at K8s
+func (uc *DynClient) Deleted(
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+) Condition {
+	return func(ctx context.Context) (bool, error) {
+		_, err := uc.Get(ctx, gvk, namespace, name)
+		if k8serrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+}
+
+// FieldEquals returns a condition that is met when the field
+// at the provided path e.g. 'status.phase' has the expected
+// value
+func (uc *DynClient) FieldEquals(
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	path string,
+	expected interface{},
+) Condition {
+	return func(ctx context.Context) (bool, error) {
+		obj, err := uc.Get(ctx, gvk, namespace, name)
+		if k8serrors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		got, found, err := unstructured.NestedFieldNoCopy(
+			obj.Object,
+			strings.Split(path, ".")...,
+		)
+		if err != nil || !found {
+			return false, err
+		}
+		// compare json equivalents since values fetched from
+		// K8s are json decoded e.g. int64 instead of int
+		want, err := toJSONObject(map[string]interface{}{"v": expected})
+		if err != nil {
+			return false, err
+		}
+		return reflect.DeepEqual(want["v"], got), nil
+	}
+}
+
+// ConditionTrue returns a condition that is met when the
+// object has a status condition of the provided type with
+// status 'True'
+func (uc *DynClient) ConditionTrue(
+	gvk schema.GroupVersionKind,
+	namespace string,
+	name string,
+	conditionType string,
+) Condition {
+	return func(ctx context.Context) (bool, error) {
+		obj, err := uc.Get(ctx, gvk, namespace, name)
+		if k8serrors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		conds, _, err := unstructured.NestedSlice(
+			obj.Object,
+			"status",
+			"conditions",
+		)
+		if err != nil {
+			return false, err
+		}
+		for _, c := range conds {
+			cond, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if cond["type"] == conditionType {
+				return cond["status"] == "True", nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// CRDEstablished returns a condition that is met when the
+// CustomResourceDefinition with the provided name is
+// established
+func (uc *DynClient) CRDEstablished(name string) Condition {
+	return uc.ConditionTrue(crdGVK, "", name, "Established")
+}
+
+// CRDNamesAccepted returns a condition that is met when the
+// names of the CustomResourceDefinition with the provided
+// name are accepted
+func (uc *DynClient) CRDNamesAccepted(name string) Condition {
+	return uc.ConditionTrue(crdGVK, "", name, "NamesAccepted")
+}
@@ -0,0 +1,170 @@
+package kgetset
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestWaitForConditions(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "openebs.io", Version: "v1", Kind: "Hello"}
+	hello := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "openebs.io/v1",
+			"kind":       "Hello",
+			"metadata":   map[string]interface{}{"name": "my-hello", "namespace": "default"},
+			"spec":       map[string]interface{}{"count": 1},
+			"status": map[string]interface{}{
+				"phase": "Up",
+				"conditions": []interface{}{
+					map[string]interface{}{"type": "Ready", "status": "True"},
+					map[string]interface{}{"type": "Degraded", "status": "False"},
+				},
+			},
+		},
+	}
+	client := NewFakeDynClientOrDie(newTestCRD("openebs.io", "hellos", "Hello", nil, nil), hello)
+
+	var tests = map[string]struct {
+		condition Condition
+		isErr     bool
+	}{
+		"exists":                 {condition: client.Exists(gvk, "default", "my-hello")},
+		"does not exist":         {condition: client.Exists(gvk, "default", "no-hello"), isErr: true},
+		"deleted":                {condition: client.Deleted(gvk, "default", "no-hello")},
+		"not deleted":            {condition: client.Deleted(gvk, "default", "my-hello"), isErr: true},
+		"field equals string":    {condition: client.FieldEquals(gvk, "default", "my-hello", "status.phase", "Up")},
+		"field equals int":       {condition: client.FieldEquals(gvk, "default", "my-hello", "spec.count", 1)},
+		"field differs":          {condition: client.FieldEquals(gvk, "default", "my-hello", "status.phase", "Down"), isErr: true},
+		"field missing":          {condition: client.FieldEquals(gvk, "default", "my-hello", "spec.desc", "hi"), isErr: true},
+		"condition true":         {condition: client.ConditionTrue(gvk, "default", "my-hello", "Ready")},
+		"condition false":        {condition: client.ConditionTrue(gvk, "default", "my-hello", "Degraded"), isErr: true},
+		"condition missing":      {condition: client.ConditionTrue(gvk, "default", "my-hello", "Synced"), isErr: true},
+		"object missing":         {condition: client.ConditionTrue(gvk, "default", "no-hello", "Ready"), isErr: true},
+		"crd established":        {condition: client.CRDEstablished("hellos.openebs.io")},
+		"crd names accepted":     {condition: client.CRDNamesAccepted("hellos.openebs.io")},
+		"crd is not established": {condition: client.CRDEstablished("byes.openebs.io"), isErr: true},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			err := WaitFor(
+				context.Background(),
+				mock.condition,
+				WithWaitTimeout(50*time.Millisecond),
+				WithWaitInterval(10*time.Millisecond),
+			)
+			if mock.isErr && err == nil {
+				t.Fatalf("test failed: expected error got nil")
+			}
+			if !mock.isErr && err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+		})
+	}
+}
+
+func TestWaitForTimeoutAndInterval(t *testing.T) {
+	var tests = map[string]struct {
+		condition func(polls int) (bool, error)
+		timeout   time.Duration
+		minPolls  int
+		maxPolls  int
+		err       string
+	}{
+		"met immediately": {
+			condition: func(int) (bool, error) { return true, nil },
+			timeout:   time.Second,
+			minPolls:  1,
+			maxPolls:  1,
+		},
+		"met on third poll": {
+			condition: func(polls int) (bool, error) { return polls == 3, nil },
+			timeout:   time.Second,
+			minPolls:  3,
+			maxPolls:  3,
+		},
+		"times out": {
+			condition: func(int) (bool, error) { return false, nil },
+			timeout:   100 * time.Millisecond,
+			minPolls:  3,
+			maxPolls:  7,
+			err:       "condition not met within 100ms",
+		},
+		"error is not polled again": {
+			condition: func(int) (bool, error) { return false, errors.New("boom") },
+			timeout:   time.Second,
+			minPolls:  1,
+			maxPolls:  1,
+			err:       "boom",
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			var polls int
+			err := WaitFor(
+				context.Background(),
+				func(context.Context) (bool, error) {
+					polls++
+					return mock.condition(polls)
+				},
+				WithWaitTimeout(mock.timeout),
+				WithWaitInterval(20*time.Millisecond),
+			)
+			if mock.err == "" && err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+			if mock.err != "" && (err == nil || !strings.Contains(err.Error(), mock.err)) {
+				t.Fatalf("test failed: expected error %q got %v", mock.err, err)
+			}
+			if polls < mock.minPolls || polls > mock.maxPolls {
+				t.Fatalf(
+					"test failed: expected %d to %d polls got %d",
+					mock.minPolls,
+					mock.maxPolls,
+					polls,
+				)
+			}
+		})
+	}
+}
+
+func TestWaitPostSteps(t *testing.T) {
+	var times []time.Time
+	step := func() error {
+		times = append(times, time.Now())
+		return nil
+	}
+	suite := &TestAbstract{
+		WaitPostSteps: []int{2},
+		WaitTime:      100 * time.Millisecond,
+		Steps: []Step{
+			NewStep("one", step),
+			NewStep("two", step),
+			NewStep("three", step),
+		},
+	}
+	// waits are at the same steps of every run
+	for run := 1; run <= 2; run++ {
+		times = nil
+		err := suite.Test()
+		if err != nil {
+			t.Fatalf("test failed: run %d: %+v", run, err)
+		}
+		if len(times) != 3 {
+			t.Fatalf("test failed: run %d: expected 3 steps got %d", run, len(times))
+		}
+		if gap := times[1].Sub(times[0]); gap >= 100*time.Millisecond {
+			t.Fatalf("test failed: run %d: expected no wait after step 1 got %s", run, gap)
+		}
+		if gap := times[2].Sub(times[1]); gap < 100*time.Millisecond {
+			t.Fatalf("test failed: run %d: expected wait after step 2 got %s", run, gap)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package kgetset
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+// WatchEvent is an event observed by a capture
+type WatchEvent struct {
+	// Seq orders this event against the other events of its
+	// capture
+	//
+	// NOTE:
+	//  Events of a single watch are sent in the order K8s
+	// produced them. Events of different captures are received
+	// by separate watches & are instead ordered by the resource
+	// versions of their objects. Refer ExpectAfterIn.
+	Seq int64
+
+	Type   watch.EventType
+	Object *unstructured.Unstructured
+	Time   time.Time
+}
+
+// String implements Stringer interface
+func (e WatchEvent) String() string {
+	return fmt.Sprintf("%d %s %s", e.Seq, e.Type, nameOf(e.Object))
+}
+
+// nameOf returns the namespace/name of the provided object
+func nameOf(obj *unstructured.Unstructured) string {
+	if obj == nil {
+		return ""
+	}
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// Capture collects the events of a watch in the order they
+// were observed
+type Capture struct {
+	gvk       schema.GroupVersionKind
+	namespace string
+
+	mu     sync.Mutex
+	seq    int64
+	events []WatchEvent
+	err    error
+	closed bool
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// Capture starts a watch on the provided kind & namespace &
+// collects its events till the context is done or the capture
+// is stopped
+//
+// NOTE:
+//  An empty namespace watches across all namespaces
+//
+// NOTE:
+//  The watch is not restarted if the server closes it. The
+// capture is then marked closed & its events are retained.
+func (uc *DynClient) Capture(
+	ctx context.Context,
+	gvk schema.GroupVersionKind,
+	namespace string,
+	options metav1.ListOptions,
+) (*Capture, error) {
+	var w watch.Interface
+	ac := apiCall{verb: "watch", gvk: gvk, namespace: namespace}
+	_, err := uc.call(ctx, ac, func(ri dynamic.ResourceInterface) (runtime.Object, error) {
+		var err error
+		w, err = ri.Watch(options)
+		return nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Capture{
+		gvk:       gvk,
+		namespace: namespace,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go c.run(ctx, w)
+	return c, nil
+}
+
+// run collects the events of the provided watch
+func (c *Capture) run(ctx context.Context, w watch.Interface) {
+	defer close(c.done)
+	defer w.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.stop:
+			return
+		case e, ok := <-w.ResultChan():
+			if !ok {
+				c.mu.Lock()
+				c.closed = true
+				c.mu.Unlock()
+				return
+			}
+			c.add(e)
+		}
+	}
+}
+
+// add records the provided watch event
+func (c *Capture) add(e watch.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e.Type == watch.Error {
+		c.err = k8serrors.FromObject(e.Object)
+		return
+	}
+	obj, ok := e.Object.(*unstructured.Unstructured)
+	if !ok {
+		c.err = errors.Errorf(
+			"unexpected watch object %T: %s %s",
+			e.Object,
+			c.gvk,
+			c.namespace,
+		)
+		return
+	}
+	c.seq++
+	c.events = append(c.events, WatchEvent{
+		Seq:    c.seq,
+		Type:   e.Type,
+		Object: obj.DeepCopy(),
+		Time:   time.Now(),
+	})
+}
+
+// Stop stops the watch & waits till the capture is done.
+// Captured events remain available.
+func (c *Capture) Stop() {
+	c.once.Do(func() { close(c.stop) })
+	<-c.done
+}
+
+// Err returns the error sent by the watch if any
+func (c *Capture) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Closed returns true if the server closed the watch
+func (c *Capture) Closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// Events returns the captured events of the provided object
+// name in the order they were observed
+//
+// NOTE:
+//  An empty name returns the events of all the objects
+func (c *Capture) Events(name string) []WatchEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var events []WatchEvent
+	for _, e := range c.events {
+		if name != "" && e.Object.GetName() != name {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// Count returns the number of captured events of the provided
+// type & object name
+func (c *Capture) Count(eventType watch.EventType, name string) int {
+	var count int
+	for _, e := range c.Events(name) {
+		if e.Type == eventType {
+			count++
+		}
+	}
+	return count
+}
+
+// Find returns the first captured event of the provided type
+// & object name
+func (c *Capture) Find(eventType watch.EventType, name string) (WatchEvent, error) {
+	for _, e := range c.Events(name) {
+		if e.Type == eventType {
+			return e, nil
+		}
+	}
+	return WatchEvent{}, errors.Errorf(
+		"%s event of %q was not captured: %s %s",
+		eventType,
+		name,
+		c.gvk,
+		c.namespace,
+	)
+}
+
+// Observed returns a condition that is true once an event of
+// the provided type & object name is captured. This is meant
+// to be used with WaitFor since events arrive asynchronously.
+func (c *Capture) Observed(eventType watch.EventType, name string) Condition {
+	return func(ctx context.Context) (bool, error) {
+		if c.Count(eventType, name) > 0 {
+			return true, nil
+		}
+		return false, c.Err()
+	}
+}
+
+// ExpectCount verifies if the provided object name has exactly
+// the expected number of captured events of the provided type
+func (c *Capture) ExpectCount(eventType watch.EventType, name string, expected int) error {
+	got := c.Count(eventType, name)
+	if got != expected {
+		return errors.Errorf(
+			"expected %d %s events of %q got %d: %v",
+			expected,
+			eventType,
+			name,
+			got,
+			c.Events(name),
+		)
+	}
+	return nil
+}
+
+// ExpectAfter verifies if the provided event of this capture
+// was observed after the other provided event of this capture
+//
+// NOTE:
+//  Ordering is verified within a single capture since only
+// the events of a single watch are ordered. Refer ExpectAfterIn
+// to order the events of different captures.
+func (c *Capture) ExpectAfter(
+	eventType watch.EventType,
+	name string,
+	otherEventType watch.EventType,
+	otherName string,
+) error {
+	e, err := c.Find(eventType, name)
+	if err != nil {
+		return err
+	}
+	o, err := c.Find(otherEventType, otherName)
+	if err != nil {
+		return err
+	}
+	if e.Seq <= o.Seq {
+		return errors.Errorf("expected %s after %s", e, o)
+	}
+	return nil
+}
+
+// ExpectAfterIn verifies if the provided event of this capture
+// was made by K8s after the other provided event of the other
+// capture. This orders the events of different kinds e.g. a CRD
+// that got deleted after its custom resources.
+//
+// NOTE:
+//  Events are ordered by the resource versions of their objects.
+// K8s documents resource versions as opaque. These are ordered
+// across kinds only since K8s stores every kind in etcd & uses
+// the etcd revision of a change as its resource version. This
+// does not hold for aggregated apis or non etcd storage.
+func (c *Capture) ExpectAfterIn(
+	other *Capture,
+	eventType watch.EventType,
+	name string,
+	otherEventType watch.EventType,
+	otherName string,
+) error {
+	e, err := c.Find(eventType, name)
+	if err != nil {
+		return err
+	}
+	o, err := other.Find(otherEventType, otherName)
+	if err != nil {
+		return err
+	}
+	rv, err := resourceVersionOf(e)
+	if err != nil {
+		return err
+	}
+	otherRV, err := resourceVersionOf(o)
+	if err != nil {
+		return err
+	}
+	if rv <= otherRV {
+		return errors.Errorf(
+			"expected %s %s after %s %s: resource version %d is not after %d",
+			c.gvk.Kind,
+			e,
+			other.gvk.Kind,
+			o,
+			rv,
+			otherRV,
+		)
+	}
+	return nil
+}
+
+// resourceVersionOf returns the resource version of the object
+// of the provided event
+func resourceVersionOf(e WatchEvent) (uint64, error) {
+	rv, err := strconv.ParseUint(e.Object.GetResourceVersion(), 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to order %s: invalid resource version", e)
+	}
+	return rv, nil
+}
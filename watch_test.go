@@ -0,0 +1,111 @@
+package kgetset
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestCaptureOrdersEvents(t *testing.T) {
+	ctx := context.Background()
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}
+	client := NewFakeDynClientOrDie()
+
+	c, err := client.Capture(ctx, gvk, "", metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	defer c.Stop()
+
+	ns := &unstructured.Unstructured{}
+	ns.SetAPIVersion("v1")
+	ns.SetKind("Namespace")
+	ns.SetName("kgetset")
+	got, err := client.Create(ctx, gvk, "", ns)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	got.SetLabels(map[string]string{"team": "storage"})
+	_, err = client.Update(ctx, gvk, "", got)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	err = client.Delete(ctx, gvk, "", "kgetset", nil)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+
+	err = WaitFor(
+		ctx,
+		c.Observed(watch.Deleted, "kgetset"),
+		WithWaitTimeout(5*time.Second),
+		WithWaitInterval(10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	err = c.ExpectCount(watch.Modified, "kgetset", 1)
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	err = c.ExpectAfter(watch.Deleted, "kgetset", watch.Modified, "kgetset")
+	if err != nil {
+		t.Fatalf("test failed: %+v", err)
+	}
+	err = c.ExpectAfter(watch.Added, "kgetset", watch.Deleted, "kgetset")
+	if err == nil {
+		t.Fatalf("test failed: expected error got nil")
+	}
+}
+
+func TestCaptureExpectAfterIn(t *testing.T) {
+	newCapture := func(kind string, name string, rv string) *Capture {
+		c := &Capture{gvk: schema.GroupVersionKind{Kind: kind}}
+		obj := &unstructured.Unstructured{}
+		obj.SetName(name)
+		obj.SetResourceVersion(rv)
+		c.add(watch.Event{Type: watch.Deleted, Object: obj})
+		return c
+	}
+
+	var tests = map[string]struct {
+		crdRV   string
+		crRV    string
+		isError bool
+	}{
+		"crd deleted after its custom resource": {
+			crdRV: "12",
+			crRV:  "10",
+		},
+		"crd deleted before its custom resource": {
+			crdRV:   "10",
+			crRV:    "12",
+			isError: true,
+		},
+		"opaque resource version": {
+			crdRV:   "v12",
+			crRV:    "10",
+			isError: true,
+		},
+	}
+	for name, mock := range tests {
+		name, mock := name, mock
+		t.Run(name, func(t *testing.T) {
+			crds := newCapture("CustomResourceDefinition", "hellos.openebs.io", mock.crdRV)
+			crs := newCapture("Hello", "my-hello", mock.crRV)
+			// both events are the first of their captures
+			err := crds.ExpectAfterIn(crs, watch.Deleted, "hellos.openebs.io", watch.Deleted, "my-hello")
+			if mock.isError && err == nil {
+				t.Fatalf("test failed: expected error got nil")
+			}
+			if !mock.isError && err != nil {
+				t.Fatalf("test failed: %+v", err)
+			}
+		})
+	}
+}